@@ -44,6 +44,8 @@ type analyticsOpts struct {
 
 type analyticsOptFn func(opts *analyticsOpts)
 
+type trackerOptFn func(t *analytics)
+
 func init() {
 	if region == "" {
 		region = os.Getenv("SM_SUPER_REGION")
@@ -133,6 +135,13 @@ func WithMessageId(messageId string) analyticsOptFn {
 	}
 }
 
+// WithPolicy will apply the policy to every event before it is published
+func WithPolicy(policy *Policy) trackerOptFn {
+	return func(t *analytics) {
+		t.policy = policy
+	}
+}
+
 func defaultTrackerOpts() *analyticsOpts {
 	return &analyticsOpts{
 		Region:  region,
@@ -183,6 +192,7 @@ type analytics struct {
 	events chan analyticsOpts
 	wg     sync.WaitGroup
 	once   sync.Once
+	policy *Policy
 }
 
 var _ Analytics = (*analytics)(nil)
@@ -196,6 +206,16 @@ func (t *analytics) Queue(name string, companyId string, locationId string, payl
 		return ErrTrackerClosed
 	default:
 	}
+	if t.policy != nil {
+		if !t.policy.Allow(name) {
+			t.logger.Trace("analytics: dropping %s event due to sample rate or rate limit", name)
+			return nil
+		}
+		var err error
+		if payload, err = t.policy.Apply(payload); err != nil {
+			return fmt.Errorf("failed to apply analytics policy to %s event: %w", name, err)
+		}
+	}
 	config := defaultTrackerOpts()
 	for _, fn := range opts {
 		fn(config)
@@ -304,7 +324,7 @@ func (t *analytics) run() {
 }
 
 // New returns a Tracker instance
-func New(ctx context.Context, logger logger.Logger, js nats.JetStreamContext) (Analytics, error) {
+func New(ctx context.Context, logger logger.Logger, js nats.JetStreamContext, opts ...trackerOptFn) (Analytics, error) {
 	_ctx, cancel := context.WithCancel(ctx)
 	t := &analytics{
 		ctx:    _ctx,
@@ -313,6 +333,9 @@ func New(ctx context.Context, logger logger.Logger, js nats.JetStreamContext) (A
 		js:     js,
 		events: make(chan analyticsOpts, 250),
 	}
+	for _, fn := range opts {
+		fn(t)
+	}
 	go t.run() // start background sender
 	return t, nil
 }
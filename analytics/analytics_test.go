@@ -3,6 +3,7 @@ package analytics
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
@@ -242,3 +243,50 @@ func TestSafeToken(t *testing.T) {
 	assert.True(t, isValidName("a.b_c"))
 	assert.True(t, isValidName("a.1"))
 }
+
+func TestAnalyticsWithPolicy(t *testing.T) {
+	server := RunTestServer(true)
+	defer server.Shutdown()
+	log := logger.NewTestLogger()
+	n, err := gnats.NewNats(log, "test", "nats://localhost:8221", nil)
+	assert.NoError(t, err, "failed to connect to nats")
+	assert.NotNil(t, n, "result was nil")
+	defer n.Close()
+	js, err := n.JetStream()
+	assert.NoError(t, err)
+	js.AddStream(&nats.StreamConfig{
+		Name:     "analytics",
+		Subjects: []string{"analytics.>"},
+	})
+	var events []Event
+	var mutex sync.Mutex
+	handler := func(ctx context.Context, payload []byte, msg *nats.Msg) error {
+		var event Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+		return msg.AckSync()
+	}
+	sub, err := gnats.NewEphemeralConsumer(log, js, "analytics", "analytics.>", handler)
+	assert.NoError(t, err)
+	defer sub.Close()
+	policy := NewPolicy(WithMaskEmailField("email"), WithDropKeys("password"), WithSampleRate("dropped", 0))
+	analytics, err := New(context.Background(), log, js, WithPolicy(policy))
+	assert.NoError(t, err)
+	assert.NoError(t, analytics.Queue("dropped", "companyId", "locationId", nil))
+	assert.NoError(t, analytics.Queue("test", "companyId", "locationId", map[string]interface{}{"email": "test@example.com", "password": "secret"}))
+	analytics.Close()
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(events) > 0
+	}, time.Second, time.Millisecond*10)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "test", events[0].Name)
+	assert.Equal(t, map[string]interface{}{"email": "te**@exa****.com"}, events[0].Data.(map[string]interface{})["payload"])
+}
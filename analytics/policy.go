@@ -0,0 +1,349 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cstring "github.com/shopmonkeyus/go-common/string"
+)
+
+// RedactFunc returns the redacted form of a value found at a redacted field path
+type RedactFunc func(val any) any
+
+// RedactMask will mask string values using string.Mask and fully mask any other non-nil value
+func RedactMask(val any) any {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		return cstring.Mask(v)
+	default:
+		return cstring.Mask(fmt.Sprint(v))
+	}
+}
+
+// RedactEmail will mask email values using string.MaskEmail and fall back to RedactMask for anything else
+func RedactEmail(val any) any {
+	if s, ok := val.(string); ok && strings.Count(s, "@") == 1 && strings.Contains(s[strings.Index(s, "@"):], ".") {
+		return cstring.MaskEmail(s)
+	}
+	return RedactMask(val)
+}
+
+// RedactRemove will replace the value with a fixed placeholder
+func RedactRemove(val any) any {
+	if val == nil {
+		return nil
+	}
+	return "[REDACTED]"
+}
+
+type rateLimit struct {
+	limit    float64
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+type redactRule struct {
+	path string
+	fn   RedactFunc
+}
+
+// Policy is applied to every event before it is published and controls redaction, dropped keys, sampling and rate limits
+type Policy struct {
+	redact    []redactRule // in the order added so the first matching rule wins
+	dropPaths []string
+	dropKeys  map[string]bool
+	samples   map[string]float64
+	limits    map[string]*rateLimit
+	mutex     sync.Mutex
+	random    func() float64
+	now       func() time.Time
+}
+
+type PolicyOpt func(p *Policy)
+
+// WithRedactField will apply fn to the value found at the dot separated field path of the payload. Use `*` to match any key or array element.
+// If more than one path matches a field the first one added is used, adding the same path again replaces its fn.
+func WithRedactField(path string, fn RedactFunc) PolicyOpt {
+	return func(p *Policy) {
+		for i, rule := range p.redact {
+			if rule.path == path {
+				p.redact[i].fn = fn
+				return
+			}
+		}
+		p.redact = append(p.redact, redactRule{path, fn})
+	}
+}
+
+// WithMaskField will mask the value found at the dot separated field path of the payload
+func WithMaskField(path string) PolicyOpt {
+	return WithRedactField(path, RedactMask)
+}
+
+// WithMaskEmailField will mask the email address found at the dot separated field path of the payload
+func WithMaskEmailField(path string) PolicyOpt {
+	return WithRedactField(path, RedactEmail)
+}
+
+// WithDropField will remove the value found at the dot separated field path of the payload
+func WithDropField(path string) PolicyOpt {
+	return func(p *Policy) {
+		if !slices.Contains(p.dropPaths, path) {
+			p.dropPaths = append(p.dropPaths, path)
+		}
+	}
+}
+
+// WithDropKeys will remove any key in the payload, at any depth, which matches one of keys (case insensitive)
+func WithDropKeys(keys ...string) PolicyOpt {
+	return func(p *Policy) {
+		for _, key := range keys {
+			p.dropKeys[strings.ToLower(key)] = true
+		}
+	}
+}
+
+// WithSampleRate will only publish the rate (0.0 to 1.0) fraction of events with the event name
+func WithSampleRate(name string, rate float64) PolicyOpt {
+	return func(p *Policy) {
+		p.samples[name] = rate
+	}
+}
+
+// WithRateLimit will only publish up to perSecond events with the event name per second, allowing bursts up to burst.
+// A perSecond of 0 (or less) drops every event with the event name.
+func WithRateLimit(name string, perSecond float64, burst int) PolicyOpt {
+	return func(p *Policy) {
+		if perSecond <= 0 {
+			burst = 0
+		} else if burst <= 0 {
+			burst = 1
+		}
+		p.limits[name] = &rateLimit{limit: perSecond, burst: float64(burst), tokens: float64(burst)}
+	}
+}
+
+// NewPolicy returns a new Policy
+func NewPolicy(opts ...PolicyOpt) *Policy {
+	p := &Policy{
+		dropKeys: make(map[string]bool),
+		samples:  make(map[string]float64),
+		limits:   make(map[string]*rateLimit),
+		random:   rand.Float64,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func splitList(val string) []string {
+	var res []string
+	for _, tok := range strings.Split(val, ",") {
+		tok = strings.TrimSpace(tok)
+		if tok != "" {
+			res = append(res, tok)
+		}
+	}
+	return res
+}
+
+// NewPolicyFromEnv returns a new Policy configured from the environment. Additional opts are applied after the environment.
+//
+//   - SM_ANALYTICS_REDACT_FIELDS: comma separated list of path[:mask|email|remove] (defaults to mask)
+//   - SM_ANALYTICS_DROP_FIELDS: comma separated list of paths to drop
+//   - SM_ANALYTICS_DROP_KEYS: comma separated list of keys to drop at any depth
+//   - SM_ANALYTICS_SAMPLE_RATES: comma separated list of name=rate
+//   - SM_ANALYTICS_RATE_LIMITS: comma separated list of name=perSecond[/burst] (a perSecond of 0 drops every event)
+func NewPolicyFromEnv(opts ...PolicyOpt) (*Policy, error) {
+	var envopts []PolicyOpt
+	for _, field := range splitList(os.Getenv("SM_ANALYTICS_REDACT_FIELDS")) {
+		path, mode, _ := strings.Cut(field, ":")
+		switch strings.ToLower(mode) {
+		case "", "mask":
+			envopts = append(envopts, WithMaskField(path))
+		case "email":
+			envopts = append(envopts, WithMaskEmailField(path))
+		case "remove":
+			envopts = append(envopts, WithRedactField(path, RedactRemove))
+		default:
+			return nil, fmt.Errorf("invalid redaction mode: '%s' for field: %s", mode, path)
+		}
+	}
+	for _, path := range splitList(os.Getenv("SM_ANALYTICS_DROP_FIELDS")) {
+		envopts = append(envopts, WithDropField(path))
+	}
+	if keys := splitList(os.Getenv("SM_ANALYTICS_DROP_KEYS")); len(keys) > 0 {
+		envopts = append(envopts, WithDropKeys(keys...))
+	}
+	for _, sample := range splitList(os.Getenv("SM_ANALYTICS_SAMPLE_RATES")) {
+		name, val, _ := strings.Cut(sample, "=")
+		rate, err := strconv.ParseFloat(val, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate: '%s' for event: %s", val, name)
+		}
+		envopts = append(envopts, WithSampleRate(name, rate))
+	}
+	for _, limit := range splitList(os.Getenv("SM_ANALYTICS_RATE_LIMITS")) {
+		name, val, _ := strings.Cut(limit, "=")
+		val, burstval, hasburst := strings.Cut(val, "/")
+		perSecond, err := strconv.ParseFloat(val, 64)
+		if err != nil || perSecond < 0 {
+			return nil, fmt.Errorf("invalid rate limit: '%s' for event: %s", val, name)
+		}
+		burst := int(perSecond)
+		if hasburst {
+			burst, err = strconv.Atoi(burstval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate limit burst: '%s' for event: %s", burstval, name)
+			}
+		}
+		envopts = append(envopts, WithRateLimit(name, perSecond, burst))
+	}
+	return NewPolicy(append(envopts, opts...)...), nil
+}
+
+// Allow returns true if the event with name should be published based on the sample rates and rate limits
+func (p *Policy) Allow(name string) bool {
+	if rate, ok := p.samples[name]; ok {
+		if rate <= 0 {
+			return false
+		}
+		if rate < 1 && p.random() >= rate {
+			return false
+		}
+	}
+	if limit, ok := p.limits[name]; ok {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		now := p.now()
+		if !limit.lastFill.IsZero() {
+			limit.tokens += now.Sub(limit.lastFill).Seconds() * limit.limit
+			if limit.tokens > limit.burst {
+				limit.tokens = limit.burst
+			}
+		}
+		limit.lastFill = now
+		if limit.tokens < 1 {
+			return false
+		}
+		limit.tokens--
+	}
+	return true
+}
+
+func (p *Policy) hasRules() bool {
+	return len(p.redact) > 0 || len(p.dropPaths) > 0 || len(p.dropKeys) > 0
+}
+
+// Apply returns a copy of the payload with the redaction and drop rules applied.
+// The payload is normalized into its JSON representation (with numbers as json.Number so large
+// integers keep their precision) before the rules are applied. The payload is returned unchanged
+// if no rule matches it.
+func (p *Policy) Apply(payload any) (any, error) {
+	if payload == nil || !p.hasRules() {
+		return payload, nil
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	res, changed := p.walk(nil, val)
+	if !changed {
+		return payload, nil
+	}
+	return res, nil
+}
+
+// walk applies the rules to val and returns the result and true if any rule matched.
+func (p *Policy) walk(path []string, val any) (any, bool) {
+	var changed bool
+	switch v := val.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := append(path[:len(path):len(path)], key)
+			if p.dropKeys[strings.ToLower(key)] || p.matchDrop(childPath) {
+				delete(v, key)
+				changed = true
+				continue
+			}
+			if fn := p.matchRedact(childPath); fn != nil {
+				v[key] = fn(child)
+				changed = true
+				continue
+			}
+			res, childChanged := p.walk(childPath, child)
+			v[key] = res
+			changed = changed || childChanged
+		}
+		return v, changed
+	case []any:
+		res := make([]any, 0, len(v))
+		for i, child := range v {
+			childPath := append(path[:len(path):len(path)], strconv.Itoa(i))
+			if p.matchDrop(childPath) {
+				changed = true
+				continue
+			}
+			if fn := p.matchRedact(childPath); fn != nil {
+				res = append(res, fn(child))
+				changed = true
+				continue
+			}
+			val, childChanged := p.walk(childPath, child)
+			res = append(res, val)
+			changed = changed || childChanged
+		}
+		return res, changed
+	}
+	return val, false
+}
+
+func (p *Policy) matchDrop(path []string) bool {
+	for _, pattern := range p.dropPaths {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matchRedact(path []string) RedactFunc {
+	for _, rule := range p.redact {
+		if matchPath(rule.path, path) {
+			return rule.fn
+		}
+	}
+	return nil
+}
+
+func matchPath(pattern string, path []string) bool {
+	tok := strings.Split(pattern, ".")
+	if len(tok) != len(path) {
+		return false
+	}
+	for i, t := range tok {
+		if t != "*" && t != path[i] {
+			return false
+		}
+	}
+	return true
+}
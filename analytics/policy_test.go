@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyRedaction(t *testing.T) {
+	p := NewPolicy(
+		WithMaskEmailField("customer.email"),
+		WithMaskField("customer.phone"),
+		WithRedactField("tokens.*", RedactRemove),
+		WithDropField("customer.notes"),
+		WithDropKeys("Password"),
+	)
+	payload := map[string]any{
+		"customer": map[string]any{
+			"email":    "test@example.com",
+			"phone":    "5551234567",
+			"notes":    "secret notes",
+			"name":     "bob",
+			"password": "hunter2",
+		},
+		"tokens": []any{"abc", "def"},
+		"nested": map[string]any{"PASSWORD": "hunter2", "ok": true},
+	}
+	res, err := p.Apply(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"customer": map[string]any{
+			"email": "te**@exa****.com",
+			"phone": "55512*****",
+			"name":  "bob",
+		},
+		"tokens": []any{"[REDACTED]", "[REDACTED]"},
+		"nested": map[string]any{"ok": true},
+	}, res)
+}
+
+func TestPolicyRedactionStruct(t *testing.T) {
+	type customer struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	p := NewPolicy(WithMaskEmailField("email"))
+	res, err := p.Apply(customer{"user@example.com", "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"email": "us**@exa****.com", "name": "alice"}, res)
+}
+
+func TestPolicyKeepsLargeNumbers(t *testing.T) {
+	p := NewPolicy(WithDropKeys("password"))
+	res, err := p.Apply(map[string]any{"id": int64(9007199254740993), "password": "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"id": json.Number("9007199254740993")}, res)
+	buf, err := json.Marshal(res)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":9007199254740993}`, string(buf))
+}
+
+func TestPolicyNoMatchReturnsPayload(t *testing.T) {
+	type event struct {
+		ID int64 `json:"id"`
+	}
+	p := NewPolicy(WithDropKeys("password"))
+	payload := event{ID: 9007199254740993}
+	res, err := p.Apply(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, res, "should return the payload unchanged when no rule matches")
+}
+
+func TestPolicyRedactEmailInvalid(t *testing.T) {
+	assert.Equal(t, "not***", RedactEmail("not-an"))
+	assert.Equal(t, "12**", RedactEmail(1234))
+	assert.Nil(t, RedactEmail(nil))
+}
+
+func TestPolicyNoRules(t *testing.T) {
+	p := NewPolicy()
+	payload := map[string]any{"foo": "bar"}
+	res, err := p.Apply(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, res)
+	assert.True(t, p.Allow("test"))
+}
+
+func TestPolicySampling(t *testing.T) {
+	p := NewPolicy(WithSampleRate("sampled", 0.5), WithSampleRate("never", 0))
+	var next float64
+	p.random = func() float64 { return next }
+	next = 0.4
+	assert.True(t, p.Allow("sampled"))
+	next = 0.6
+	assert.False(t, p.Allow("sampled"))
+	assert.False(t, p.Allow("never"))
+	assert.True(t, p.Allow("other"))
+}
+
+func TestPolicyRateLimit(t *testing.T) {
+	p := NewPolicy(WithRateLimit("limited", 2, 2))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	assert.True(t, p.Allow("limited"))
+	assert.True(t, p.Allow("limited"))
+	assert.False(t, p.Allow("limited"))
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, p.Allow("limited"))
+	assert.False(t, p.Allow("limited"))
+	now = now.Add(10 * time.Second)
+	assert.True(t, p.Allow("limited"))
+	assert.True(t, p.Allow("limited"))
+	assert.False(t, p.Allow("limited"))
+	assert.True(t, p.Allow("other"))
+}
+
+func TestPolicyRateLimitZero(t *testing.T) {
+	p := NewPolicy(WithRateLimit("never", 0, 5))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	assert.False(t, p.Allow("never"))
+	now = now.Add(time.Minute)
+	assert.False(t, p.Allow("never"))
+
+	t.Setenv("SM_ANALYTICS_RATE_LIMITS", "never=0")
+	p, err := NewPolicyFromEnv()
+	assert.NoError(t, err)
+	assert.False(t, p.Allow("never"))
+
+	t.Setenv("SM_ANALYTICS_RATE_LIMITS", "never=-1")
+	_, err = NewPolicyFromEnv()
+	assert.EqualError(t, err, "invalid rate limit: '-1' for event: never")
+}
+
+func TestPolicyFirstMatchingPathWins(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		p := NewPolicy(
+			WithRedactField("user.*", RedactRemove),
+			WithMaskField("user.name"),
+			WithMaskField("other.*"),
+			WithRedactField("other.*", RedactRemove),
+		)
+		res, err := p.Apply(map[string]any{"user": map[string]any{"name": "bob"}, "other": map[string]any{"name": "bob"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"user": map[string]any{"name": "[REDACTED]"}, "other": map[string]any{"name": "[REDACTED]"}}, res)
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("SM_ANALYTICS_REDACT_FIELDS", "email:email, phone, token:remove")
+	t.Setenv("SM_ANALYTICS_DROP_FIELDS", "notes")
+	t.Setenv("SM_ANALYTICS_DROP_KEYS", "password,ssn")
+	t.Setenv("SM_ANALYTICS_SAMPLE_RATES", "page.view=0.25")
+	t.Setenv("SM_ANALYTICS_RATE_LIMITS", "click=10/20")
+	p, err := NewPolicyFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, p.samples["page.view"])
+	assert.Equal(t, float64(10), p.limits["click"].limit)
+	assert.Equal(t, float64(20), p.limits["click"].burst)
+	res, err := p.Apply(map[string]any{"email": "a@b.io", "phone": "1234", "token": "abc", "notes": "x", "password": "y", "ok": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"email": "*@*.io", "phone": "12**", "token": "[REDACTED]", "ok": json.Number("1")}, res)
+}
+
+func TestPolicyFromEnvInvalid(t *testing.T) {
+	t.Setenv("SM_ANALYTICS_SAMPLE_RATES", "page.view=2")
+	_, err := NewPolicyFromEnv()
+	assert.EqualError(t, err, "invalid sample rate: '2' for event: page.view")
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const defaultAdminLimit = 100
+
+type adminKey struct {
+	Key  string `json:"key"`
+	Hits int    `json:"hits"`
+	TTL  string `json:"ttl"`
+	Age  string `json:"age"`
+	Cost int64  `json:"cost,omitempty"`
+}
+
+type adminResponse struct {
+	Stats Stats      `json:"stats"`
+	Len   int        `json:"len"`
+	Keys  []adminKey `json:"keys"`
+}
+
+// NewAdminHandler returns a http.Handler which responds to GET requests with the cache statistics and the metadata
+// for the keys in the cache as JSON for debugging. The prefix query parameter filters the keys and the limit query
+// parameter sets the maximum number of keys returned (defaults to 100).
+func NewAdminHandler(c Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		limit := defaultAdminLimit
+		if val := r.URL.Query().Get("limit"); val != "" {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		count, err := c.Len()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		keys, err := c.Keys(r.URL.Query().Get("prefix"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sort.Strings(keys)
+		resp := adminResponse{Stats: c.Stats(), Len: count, Keys: []adminKey{}}
+		for _, key := range keys {
+			if len(resp.Keys) >= limit {
+				break
+			}
+			found, info, err := c.Info(key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				continue // expired since listing the keys
+			}
+			resp.Keys = append(resp.Keys, adminKey{
+				Key:  key,
+				Hits: info.Hits,
+				TTL:  info.TTL.String(),
+				Age:  info.Age.String(),
+				Cost: info.Cost,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
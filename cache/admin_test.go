@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	assert.NoError(t, c.SetMany(map[string]any{"dns:a": 1, "dns:b": 2, "schema:a": 3}, time.Minute))
+	c.Get("dns:a")
+	c.Get("missing")
+	handler := NewAdminHandler(c)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?prefix=dns:&limit=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var resp adminResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 3, resp.Len)
+	assert.Equal(t, uint64(1), resp.Stats.Hits)
+	assert.Equal(t, uint64(1), resp.Stats.Misses)
+	assert.Len(t, resp.Keys, 1)
+	assert.Equal(t, "dns:a", resp.Keys[0].Key)
+	assert.Equal(t, 1, resp.Keys[0].Hits)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?limit=abc", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
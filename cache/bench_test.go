@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const benchmarkKeys = 1 << 14
+
+func benchmarkKeyNames() []string {
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func benchmarkParallel(b *testing.B, c *TypedCache[string, any], writePercent int) {
+	keys := benchmarkKeyNames()
+	for _, key := range keys {
+		c.Set(key, key, time.Hour)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// start each goroutine at a different key so they don't all contend on the same shard
+		i := rand.Intn(benchmarkKeys)
+		for pb.Next() {
+			key := keys[i&(benchmarkKeys-1)]
+			if i%100 < writePercent {
+				c.Set(key, key, time.Hour)
+			} else {
+				c.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkParallelGet(b *testing.B) {
+	for _, shards := range []int{1, 16, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			c := NewTyped(context.Background(), TypedConfig[string, any]{Shards: shards})
+			defer c.Close()
+			benchmarkParallel(b, c, 0)
+		})
+	}
+}
+
+func BenchmarkParallelSet(b *testing.B) {
+	for _, shards := range []int{1, 16, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			c := NewTyped(context.Background(), TypedConfig[string, any]{Shards: shards})
+			defer c.Close()
+			benchmarkParallel(b, c, 100)
+		})
+	}
+}
+
+func BenchmarkParallelMixed(b *testing.B) {
+	for _, shards := range []int{1, 16, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			c := NewTyped(context.Background(), TypedConfig[string, any]{Shards: shards, MaxEntries: benchmarkKeys})
+			defer c.Close()
+			benchmarkParallel(b, c, 10)
+		})
+	}
+}
+
+func BenchmarkInMemoryParallelGetSet(b *testing.B) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	keys := benchmarkKeyNames()
+	for _, key := range keys {
+		c.Set(key, key, time.Hour)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// start each goroutine at a different key so they don't all contend on the same shard
+		i := rand.Intn(benchmarkKeys)
+		for pb.Next() {
+			key := keys[i&(benchmarkKeys-1)]
+			if i%10 == 0 {
+				c.Set(key, key, time.Hour)
+			} else {
+				c.Get(key)
+			}
+			i++
+		}
+	})
+}
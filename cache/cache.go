@@ -1,9 +1,22 @@
 package cache
 
 import (
+	"context"
 	"time"
 )
 
+// KeyInfo is the metadata for a key in the cache.
+type KeyInfo struct {
+	// Hits is the number of times the key has been accessed.
+	Hits int `json:"hits"`
+	// TTL is the time remaining until the key expires.
+	TTL time.Duration `json:"ttl"`
+	// Age is the time since the value was set.
+	Age time.Duration `json:"age"`
+	// Cost is the cost of the entry, only set by in-memory caches.
+	Cost int64 `json:"cost,omitempty"`
+}
+
 type Cache interface {
 	// Get a value from the cache and return true if found, any is the value if found and nil if no error.
 	Get(key string) (bool, any, error)
@@ -14,15 +27,43 @@ type Cache interface {
 	// Hits returns the number of times a key has been accessed.
 	Hits(key string) (bool, int)
 
+	// TTL returns the time remaining until a key expires and true if found.
+	TTL(key string) (bool, time.Duration, error)
+
+	// Info returns the metadata for a key and true if found. Info doesn't count as an access of the key.
+	Info(key string) (bool, KeyInfo, error)
+
+	// Keys returns the unexpired keys in the cache which start with prefix.
+	Keys(prefix string) ([]string, error)
+
+	// Len returns the number of entries in the cache which may include expired entries which haven't been removed yet.
+	Len() (int, error)
+
+	// Range calls fn for each unexpired entry in the cache until fn returns false. Range doesn't count as an access of the keys.
+	Range(fn func(key string, val any) bool) error
+
+	// GetMany returns the values found in the cache for keys.
+	GetMany(keys []string) (map[string]any, error)
+
+	// SetMany sets the values into the cache with a cache expiration.
+	SetMany(vals map[string]any, expires time.Duration) error
+
+	// GetOrLoad will return a value from the cache or call loader to load it and set it into the cache with a cache expiration.
+	// Concurrent calls for the same key will share a single call to loader.
+	GetOrLoad(ctx context.Context, key string, loader Loader, expires time.Duration) (any, error)
+
 	// Expire will expire a key in the cache.
 	Expire(key string) (bool, error)
 
+	// ExpireMany will expire keys in the cache and return the number of keys found.
+	ExpireMany(keys []string) (int, error)
+
+	// ExpirePrefix will expire all keys which start with prefix and return the number of keys found.
+	ExpirePrefix(prefix string) (int, error)
+
+	// Stats returns the cache statistics.
+	Stats() Stats
+
 	// Close will shutdown the cache.
 	Close() error
 }
-
-type value struct {
-	object  any
-	expires time.Time
-	hits    int
-}
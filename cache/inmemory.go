@@ -2,88 +2,142 @@ package cache
 
 import (
 	"context"
+	"io"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/shopmonkeyus/go-common/logger"
 )
 
 type inMemoryCache struct {
-	ctx         context.Context
-	cancel      context.CancelFunc
-	cache       map[string]*value
-	mutex       sync.Mutex
-	waitGroup   sync.WaitGroup
-	once        sync.Once
-	expiryCheck time.Duration
+	cache            *TypedCache[string, any]
+	ctx              context.Context
+	cancel           context.CancelFunc
+	snapshotFile     string
+	snapshotInterval time.Duration
+	waitGroup        sync.WaitGroup
+	once             sync.Once
 }
 
 var _ Cache = (*inMemoryCache)(nil)
+var _ Snapshotter = (*inMemoryCache)(nil)
 
 func (c *inMemoryCache) Get(key string) (bool, any, error) {
-	c.mutex.Lock()
-	val, ok := c.cache[key]
-	if ok {
-		val.hits++
-	}
-	c.mutex.Unlock()
-	if ok {
-		if val.expires.Before(time.Now()) {
-			c.mutex.Lock()
-			delete(c.cache, key)
-			c.mutex.Unlock()
-			return false, nil, nil
-		}
-		return true, val.object, nil
-	}
-	return false, nil, nil
+	val, ok := c.cache.Get(key)
+	return ok, val, nil
 }
 
 // Hits returns the number of times a key has been accessed.
 func (c *inMemoryCache) Hits(key string) (bool, int) {
-	c.mutex.Lock()
-	var val int
-	var found bool
-	if v, ok := c.cache[key]; ok {
-		val = v.hits
-		found = true
+	return c.cache.Hits(key)
+}
+
+func (c *inMemoryCache) TTL(key string) (bool, time.Duration, error) {
+	ttl, ok := c.cache.TTL(key)
+	return ok, ttl, nil
+}
+
+func (c *inMemoryCache) Info(key string) (bool, KeyInfo, error) {
+	info, ok := c.cache.Info(key)
+	return ok, info, nil
+}
+
+func (c *inMemoryCache) Keys(prefix string) ([]string, error) {
+	var keys []string
+	c.cache.Range(func(key string, _ any) bool {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, nil
+}
+
+func (c *inMemoryCache) Len() (int, error) {
+	return c.cache.Len(), nil
+}
+
+func (c *inMemoryCache) Range(fn func(key string, val any) bool) error {
+	c.cache.Range(fn)
+	return nil
+}
+
+func (c *inMemoryCache) GetMany(keys []string) (map[string]any, error) {
+	vals := make(map[string]any, len(keys))
+	for _, key := range keys {
+		if val, ok := c.cache.Get(key); ok {
+			vals[key] = val
+		}
 	}
-	c.mutex.Unlock()
-	return found, val
+	return vals, nil
 }
 
 func (c *inMemoryCache) Set(key string, val any, expires time.Duration) error {
-	c.mutex.Lock()
-	if v, ok := c.cache[key]; ok {
-		v.hits = 0
-		v.expires = time.Now().Add(expires)
-		v.object = val
-	} else {
-		c.cache[key] = &value{val, time.Now().Add(expires), 0}
+	c.cache.Set(key, val, expires)
+	return nil
+}
+
+func (c *inMemoryCache) SetMany(vals map[string]any, expires time.Duration) error {
+	for key, val := range vals {
+		c.cache.Set(key, val, expires)
 	}
-	c.mutex.Unlock()
 	return nil
 }
 
+func (c *inMemoryCache) GetOrLoad(ctx context.Context, key string, loader Loader, expires time.Duration) (any, error) {
+	return c.cache.GetOrLoad(ctx, key, loader, expires)
+}
+
 func (c *inMemoryCache) Expire(key string) (bool, error) {
-	c.mutex.Lock()
-	_, ok := c.cache[key]
-	if ok {
-		delete(c.cache, key)
+	return c.cache.Expire(key), nil
+}
+
+func (c *inMemoryCache) ExpireMany(keys []string) (int, error) {
+	var count int
+	for _, key := range keys {
+		if c.cache.Expire(key) {
+			count++
+		}
 	}
-	c.mutex.Unlock()
-	return ok, nil
+	return count, nil
+}
+
+func (c *inMemoryCache) ExpirePrefix(prefix string) (int, error) {
+	keys, _ := c.Keys(prefix)
+	return c.ExpireMany(keys)
+}
+
+func (c *inMemoryCache) Stats() Stats {
+	return c.cache.Stats()
+}
+
+// Snapshot writes the unexpired entries in the cache to w. Values are gob encoded so any custom types stored in
+// the cache must be registered with gob.Register, entries which can't be encoded are skipped.
+func (c *inMemoryCache) Snapshot(w io.Writer) error {
+	return c.cache.Snapshot(w)
+}
+
+// Restore reads a snapshot written by Snapshot into the cache, skipping entries which have since expired.
+func (c *inMemoryCache) Restore(r io.Reader) error {
+	return c.cache.Restore(r)
 }
 
 func (c *inMemoryCache) Close() error {
+	var err error
 	c.once.Do(func() {
 		c.cancel()
 		c.waitGroup.Wait()
+		if c.snapshotFile != "" {
+			err = writeSnapshotFile(c, c.snapshotFile)
+		}
+		c.cache.Close()
 	})
-	return nil
+	return err
 }
 
-func (c *inMemoryCache) run() {
-	c.waitGroup.Add(1)
-	timer := time.NewTicker(c.expiryCheck)
+func (c *inMemoryCache) runSnapshots() {
+	timer := time.NewTicker(c.snapshotInterval)
 	defer func() {
 		timer.Stop()
 		c.waitGroup.Done()
@@ -93,33 +147,78 @@ func (c *inMemoryCache) run() {
 		case <-c.ctx.Done():
 			return
 		case <-timer.C:
-			now := time.Now()
-			c.mutex.Lock()
-			var expired []string
-			for key, val := range c.cache {
-				if val.expires.Before(now) {
-					expired = append(expired, key)
-				}
-			}
-			if len(expired) > 0 {
-				for _, key := range expired {
-					delete(c.cache, key)
-				}
+			if err := writeSnapshotFile(c, c.snapshotFile); err != nil {
+				logger.FromContext(c.ctx).Warn("failed to write cache snapshot to %s: %s", c.snapshotFile, err)
 			}
-			c.mutex.Unlock()
 		}
 	}
 }
 
+type inMemoryOpts struct {
+	config           TypedConfig[string, any]
+	snapshotFile     string
+	snapshotInterval time.Duration
+}
+
+type InMemoryOpt func(opts *inMemoryOpts)
+
+// WithStaleWhileRevalidate will allow GetOrLoad to return expired values for up to window while they are reloaded in the background.
+func WithStaleWhileRevalidate(window time.Duration) InMemoryOpt {
+	return func(opts *inMemoryOpts) {
+		opts.config.StaleWhileRevalidate = window
+	}
+}
+
+// WithNegativeTTL will cache loader errors returned to GetOrLoad for ttl.
+func WithNegativeTTL(ttl time.Duration) InMemoryOpt {
+	return func(opts *inMemoryOpts) {
+		opts.config.NegativeTTL = ttl
+	}
+}
+
+// WithJitter will randomly add or remove up to fraction (0.0 to 1.0) of the expiration of values loaded by GetOrLoad.
+func WithJitter(fraction float64) InMemoryOpt {
+	return func(opts *inMemoryOpts) {
+		opts.config.Jitter = fraction
+	}
+}
+
+// WithSnapshotFile will restore the cache from filename when it is created (if the file exists), write a snapshot
+// to filename every interval (0 disables periodic snapshots) and write a final snapshot when the cache is closed.
+// Snapshots are written to a temporary file which is renamed to filename so a partial snapshot is never read.
+// Errors reading the snapshot (other than a missing file) and writing the periodic snapshots are logged with the
+// logger from the parent context (see logger.WithContext).
+func WithSnapshotFile(filename string, interval time.Duration) InMemoryOpt {
+	return func(opts *inMemoryOpts) {
+		opts.snapshotFile = filename
+		opts.snapshotInterval = interval
+	}
+}
+
 // New returns a new Cache implementation
-func NewInMemory(parent context.Context, expiryCheck time.Duration) Cache {
+func NewInMemory(parent context.Context, expiryCheck time.Duration, opts ...InMemoryOpt) Cache {
+	var c inMemoryOpts
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.config.ExpiryCheck = expiryCheck
 	ctx, cancel := context.WithCancel(parent)
-	c := &inMemoryCache{
-		ctx:         ctx,
-		cancel:      cancel,
-		cache:       make(map[string]*value),
-		expiryCheck: expiryCheck,
+	cache := &inMemoryCache{
+		cache:            NewTyped(parent, c.config),
+		ctx:              ctx,
+		cancel:           cancel,
+		snapshotFile:     c.snapshotFile,
+		snapshotInterval: c.snapshotInterval,
+	}
+	if cache.snapshotFile != "" {
+		// a missing or unreadable snapshot isn't fatal, the cache just starts cold
+		if err := readSnapshotFile(cache, cache.snapshotFile); err != nil {
+			logger.FromContext(parent).Warn("failed to read cache snapshot from %s: %s", cache.snapshotFile, err)
+		}
+		if cache.snapshotInterval > 0 {
+			cache.waitGroup.Add(1)
+			go cache.runSnapshots()
+		}
 	}
-	go c.run()
-	return c
+	return cache
 }
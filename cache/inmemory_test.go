@@ -56,9 +56,7 @@ func TestCacheBackgroundExpire(t *testing.T) {
 	assert.Equal(t, "value", val)
 	time.Sleep(time.Millisecond * 200)
 	c := cache.(*inMemoryCache)
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	assert.Empty(t, c.cache)
+	assert.Equal(t, 0, c.cache.Len())
 	cache.Close()
 	cancel()
 }
@@ -77,9 +75,87 @@ func TestCacheExpire(t *testing.T) {
 	assert.Equal(t, "value", val)
 	cache.Expire("test")
 	c := cache.(*inMemoryCache)
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	assert.Empty(t, c.cache)
+	assert.Equal(t, 0, c.cache.Len())
 	cache.Close()
 	cancel()
 }
+
+func TestSetKeepsHits(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	assert.NoError(t, c.Set("test", "value", time.Minute))
+	c.Get("test")
+	c.Get("test")
+	assert.NoError(t, c.Set("test", "other", time.Minute))
+	ok, hits := c.Hits("test")
+	assert.True(t, ok)
+	assert.Equal(t, 2, hits)
+}
+
+func TestCacheInfo(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	found, _, err := c.Info("test")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, c.Set("test", "value", time.Minute))
+	c.Get("test")
+	time.Sleep(time.Millisecond * 5)
+	found, info, err := c.Info("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, info.Hits)
+	assert.Greater(t, info.TTL, time.Second*59)
+	assert.LessOrEqual(t, info.TTL, time.Minute)
+	assert.GreaterOrEqual(t, info.Age, time.Millisecond*5)
+	_, hits := c.Hits("test")
+	assert.Equal(t, 1, hits, "info shouldn't count as a hit")
+	found, ttl, err := c.TTL("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, time.Minute, ttl.Round(time.Second))
+}
+
+func TestCacheKeysAndRange(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	assert.NoError(t, c.SetMany(map[string]any{"dns:a": 1, "dns:b": 2, "schema:a": 3}, time.Minute))
+	assert.NoError(t, c.Set("dns:expired", 4, time.Millisecond))
+	time.Sleep(time.Millisecond * 2)
+	keys, err := c.Keys("dns:")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"dns:a", "dns:b"}, keys)
+	count, err := c.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	vals := make(map[string]any)
+	assert.NoError(t, c.Range(func(key string, val any) bool {
+		vals[key] = val
+		return true
+	}))
+	assert.Equal(t, map[string]any{"dns:a": 1, "dns:b": 2, "schema:a": 3}, vals)
+	var calls int
+	assert.NoError(t, c.Range(func(key string, val any) bool {
+		calls++
+		return false
+	}))
+	assert.Equal(t, 1, calls)
+}
+
+func TestCacheBulk(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	assert.NoError(t, c.SetMany(map[string]any{"dns:a": 1, "dns:b": 2, "schema:a": 3, "schema:b": 4}, time.Minute))
+	vals, err := c.GetMany([]string{"dns:a", "schema:a", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"dns:a": 1, "schema:a": 3}, vals)
+	count, err := c.ExpireMany([]string{"schema:a", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = c.ExpirePrefix("dns:")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	keys, err := c.Keys("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"schema:b"}, keys)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrLoaderPanic = errors.New("loader panicked")
+
+// Loader loads the value for a key on a cache miss.
+type Loader func(ctx context.Context) (any, error)
+
+type flight[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// flightGroup coalesces concurrent loads of the same key into a single call to the loader.
+type flightGroup[K comparable, V any] struct {
+	mutex   sync.Mutex
+	flights map[K]*flight[V]
+}
+
+// do calls fn for the key unless a call for the key is already in flight, in which case it waits for its result.
+// fn runs in its own goroutine so a caller whose context is done stops waiting without failing the other callers.
+// A panic in fn is returned as an ErrLoaderPanic error to every caller.
+func (g *flightGroup[K, V]) do(ctx context.Context, key K, fn func() (V, error)) (V, error) {
+	g.mutex.Lock()
+	if g.flights == nil {
+		g.flights = make(map[K]*flight[V])
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		f = &flight[V]{done: make(chan struct{})}
+		g.flights[key] = f
+		go g.call(key, f, fn)
+	}
+	g.mutex.Unlock()
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var val V
+		return val, ctx.Err()
+	}
+}
+
+// call calls fn and completes the flight, even if fn panics, so later loads of the key aren't blocked.
+func (g *flightGroup[K, V]) call(key K, f *flight[V], fn func() (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.err = fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+		}
+		g.mutex.Lock()
+		delete(g.flights, key)
+		g.mutex.Unlock()
+		close(f.done)
+	}()
+	f.val, f.err = fn()
+}
+
+// inFlight returns true if a load for the key is in flight.
+func (g *flightGroup[K, V]) inFlight(key K) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	_, ok := g.flights[key]
+	return ok
+}
+
+func (c *TypedCache[K, V]) jitter(ttl time.Duration) time.Duration {
+	if c.config.Jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	// more than 1 could make the ttl negative and store the entry already expired
+	jitter := min(c.config.Jitter, 1)
+	return ttl + time.Duration((rand.Float64()*2-1)*jitter*float64(ttl))
+}
+
+// load calls loader (coalescing concurrent loads) and stores the result. Errors from a background refresh aren't
+// cached so that the stale value continues to be served until it is removed.
+func (c *TypedCache[K, V]) load(ctx context.Context, key K, hash uint64, loader func(ctx context.Context) (V, error), ttl time.Duration, refresh bool) (V, error) {
+	return c.flights.do(ctx, key, func() (V, error) {
+		// the load is shared by every caller waiting for the key so it isn't cancelled with the first caller
+		val, err := loader(context.WithoutCancel(ctx))
+		s := c.shards[hash&c.mask]
+		var evicted []eviction[K, V]
+		if err == nil {
+			cost := int64(1)
+			if c.config.Cost != nil {
+				cost = c.config.Cost(key, val)
+			}
+			_, evicted = s.set(key, hash, val, nil, cost, time.Now().Add(c.jitter(ttl)))
+		} else if c.config.NegativeTTL > 0 && !refresh && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			var empty V
+			_, evicted = s.set(key, hash, empty, err, 1, time.Now().Add(c.jitter(c.config.NegativeTTL)))
+		}
+		c.notify(evicted)
+		return val, err
+	})
+}
+
+// GetOrLoad returns the value for the key from the cache or calls loader to load it and store it with the ttl.
+// Concurrent calls for the same key share a single call to loader. If StaleWhileRevalidate is configured, an
+// expired value is returned immediately while it is reloaded in the background. If NegativeTTL is configured,
+// loader errors are cached and returned without calling loader again until they expire.
+func (c *TypedCache[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error), ttl time.Duration) (V, error) {
+	s, hash := c.shard(key)
+	val, err, state, evicted := s.lookup(key, hash, time.Now())
+	c.notify(evicted)
+	switch state {
+	case lookupFresh:
+		if err == nil {
+			c.hits.Add(1)
+		} else {
+			c.misses.Add(1)
+		}
+		return val, err
+	case lookupStale:
+		c.hits.Add(1)
+		c.closeMutex.Lock()
+		// check closed and add to the wait group under the lock Close takes before waiting
+		if !c.closed && !c.flights.inFlight(key) {
+			c.waitGroup.Add(1)
+			go func() {
+				defer c.waitGroup.Done()
+				c.load(context.WithoutCancel(ctx), key, hash, loader, ttl, true)
+			}()
+		}
+		c.closeMutex.Unlock()
+		return val, nil
+	}
+	c.misses.Add(1)
+	return c.load(ctx, key, hash, loader, ttl, false)
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	var calls int
+	loader := func(ctx context.Context) (any, error) {
+		calls++
+		return "value", nil
+	}
+	val, err := c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+	val, err = c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+	assert.Equal(t, 1, calls)
+	found, val, err := c.Get("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "value", val)
+}
+
+func TestGetOrLoadCoalescing(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, err := c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+			assert.NoError(t, err)
+			results[i] = val
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+	for _, val := range results {
+		assert.Equal(t, 42, val)
+	}
+}
+
+func TestGetOrLoadWaiterCanceled(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	release := make(chan struct{})
+	go c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	}, time.Minute)
+	time.Sleep(time.Millisecond * 10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := c.GetOrLoad(ctx, "test", func(ctx context.Context) (int, error) {
+		return 2, nil
+	}, time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(release)
+}
+
+func TestGetOrLoadStaleWhileRevalidate(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{StaleWhileRevalidate: time.Second})
+	defer c.Close()
+	var calls atomic.Int32
+	refreshed := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		n := calls.Add(1)
+		if n == 2 {
+			defer close(refreshed)
+		}
+		return int(n), nil
+	}
+	val, err := c.GetOrLoad(context.Background(), "test", loader, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val)
+	time.Sleep(time.Millisecond * 5)
+	_, ok := c.Get("test")
+	assert.False(t, ok, "stale values shouldn't be returned by Get")
+	val, err = c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val, "should serve stale value while refreshing")
+	<-refreshed
+	time.Sleep(time.Millisecond * 5)
+	val, err = c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, val)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestGetOrLoadStaleRefreshError(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{StaleWhileRevalidate: time.Second, NegativeTTL: time.Minute})
+	defer c.Close()
+	val, err := c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) { return 1, nil }, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val)
+	time.Sleep(time.Millisecond * 5)
+	failed := make(chan struct{})
+	val, err = c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) {
+		defer close(failed)
+		return 0, errors.New("boom")
+	}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val)
+	<-failed
+	time.Sleep(time.Millisecond * 5)
+	val, err = c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) { return 0, errors.New("boom") }, time.Minute)
+	assert.NoError(t, err, "a failed refresh shouldn't replace the stale value")
+	assert.Equal(t, 1, val)
+}
+
+func TestGetOrLoadNegativeCaching(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute, WithNegativeTTL(time.Millisecond*20))
+	defer c.Close()
+	var calls int
+	boom := errors.New("boom")
+	loader := func(ctx context.Context) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, boom
+		}
+		return "value", nil
+	}
+	_, err := c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.ErrorIs(t, err, boom)
+	_, err = c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, 1, calls)
+	found, _, _ := c.Get("test")
+	assert.False(t, found, "negative entries shouldn't be returned by Get")
+	time.Sleep(time.Millisecond * 25)
+	val, err := c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetOrLoadNoNegativeCaching(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	var calls int
+	loader := func(ctx context.Context) (any, error) {
+		calls++
+		return nil, errors.New("boom")
+	}
+	c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetOrLoadJitter(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{Jitter: 0.5})
+	defer c.Close()
+	var different bool
+	for i := 0; i < 10; i++ {
+		ttl := c.jitter(time.Minute)
+		assert.GreaterOrEqual(t, ttl, 30*time.Second)
+		assert.LessOrEqual(t, ttl, 90*time.Second)
+		if ttl != time.Minute {
+			different = true
+		}
+	}
+	assert.True(t, different)
+
+	c = NewTyped(context.Background(), TypedConfig[string, int]{Jitter: 5})
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		ttl := c.jitter(time.Minute)
+		assert.GreaterOrEqual(t, ttl, time.Duration(0), "jitter should be clamped to 1")
+		assert.LessOrEqual(t, ttl, 2*time.Minute)
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	release := make(chan struct{})
+	waiting := make(chan error, 1)
+	go func() {
+		<-release
+		_, err := c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) { return 0, nil }, time.Minute)
+		waiting <- err
+	}()
+	_, err := c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) {
+		close(release)
+		time.Sleep(time.Millisecond * 20) // let the second call join the flight
+		panic("boom")
+	}, time.Minute)
+	assert.ErrorIs(t, err, ErrLoaderPanic)
+	select {
+	case err := <-waiting:
+		assert.ErrorIs(t, err, ErrLoaderPanic, "the waiter should get the panic as an error")
+	case <-time.After(time.Second):
+		t.Fatal("waiter blocked after the loader panicked")
+	}
+	val, err := c.GetOrLoad(context.Background(), "test", func(ctx context.Context) (int, error) { return 42, nil }, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, val)
+}
+
+func TestGetOrLoadCancelledCallerDoesntFailWaiters(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(ctx, "test", loader, time.Minute)
+		leader <- err
+	}()
+	time.Sleep(time.Millisecond * 20)
+	waiter := make(chan int, 1)
+	go func() {
+		val, err := c.GetOrLoad(context.Background(), "test", loader, time.Minute)
+		assert.NoError(t, err)
+		waiter <- val
+	}()
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+	assert.ErrorIs(t, <-leader, context.Canceled)
+	close(release)
+	assert.Equal(t, 42, <-waiter)
+}
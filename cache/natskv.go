@@ -0,0 +1,479 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/shopmonkeyus/go-common/logger"
+	cstring "github.com/shopmonkeyus/go-common/string"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// kvEnvelope is the msgpack encoded value stored in the KV bucket.
+type kvEnvelope struct {
+	Value   any    `msgpack:"v"`
+	Expires int64  `msgpack:"e"` // unix nanoseconds
+	Origin  string `msgpack:"o"`
+}
+
+func (e *kvEnvelope) expired(now time.Time) bool {
+	return e.Expires <= now.UnixNano()
+}
+
+type natsKVCache struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	kv        nats.KeyValue
+	origin    string
+	local     *TypedCache[string, any]
+	watcher   nats.KeyWatcher
+	hits      *TypedCache[string, int] // bounded and expiring with the values so it doesn't grow forever
+	mutex     sync.Mutex
+	flights   flightGroup[string, any]
+	waitGroup sync.WaitGroup
+	once      sync.Once
+	stats     struct {
+		hits        atomic.Uint64
+		misses      atomic.Uint64
+		expirations atomic.Uint64
+	}
+}
+
+var _ Cache = (*natsKVCache)(nil)
+
+const hexDigits = "0123456789ABCDEF"
+
+// encodeKVKey escapes any characters in key which aren't safe to use in a KV key as =XX.
+// the encoding is done per character so the encoded form of a prefix is a prefix of the encoded key.
+func encodeKVKey(key string) string {
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '/' {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('=')
+		sb.WriteByte(hexDigits[c>>4])
+		sb.WriteByte(hexDigits[c&0xf])
+	}
+	return sb.String()
+}
+
+func decodeKVKey(key string) string {
+	if !strings.Contains(key, "=") {
+		return key
+	}
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] == '=' && i+2 < len(key) {
+			hi := strings.IndexByte(hexDigits, key[i+1])
+			lo := strings.IndexByte(hexDigits, key[i+2])
+			if hi >= 0 && lo >= 0 {
+				sb.WriteByte(byte(hi<<4 | lo))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(key[i])
+	}
+	return sb.String()
+}
+
+func (c *natsKVCache) read(key string) (*kvEnvelope, error) {
+	env, _, err := c.readEntry(key)
+	return env, err
+}
+
+func (c *natsKVCache) readEntry(key string) (*kvEnvelope, nats.KeyValueEntry, error) {
+	entry, err := c.kv.Get(encodeKVKey(key))
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to get %s from kv: %w", key, err)
+	}
+	var env kvEnvelope
+	if err := msgpack.Unmarshal(entry.Value(), &env); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode %s from kv: %w", key, err)
+	}
+	if env.expired(time.Now()) {
+		// lazily remove expired values, the bucket TTL (if set) is an upper bound for anything never read again.
+		// only delete the revision we read so a value just written by another instance isn't removed.
+		if err := c.kv.Delete(encodeKVKey(key), nats.LastRevision(entry.Revision())); err != nil && !isWrongLastSequence(err) {
+			logger.FromContext(c.ctx).Warn("failed to delete expired %s from kv: %s", key, err)
+		}
+		c.stats.expirations.Add(1)
+		return nil, nil, nil
+	}
+	return &env, entry, nil
+}
+
+// isWrongLastSequence returns true if the error is because the key was changed since it was read.
+func isWrongLastSequence(err error) bool {
+	var apiErr *nats.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence
+}
+
+// scan calls fn with each unexpired value in the bucket whose key starts with prefix until fn returns false.
+func (c *natsKVCache) scan(prefix string, fn func(key string, env *kvEnvelope, entry nats.KeyValueEntry) bool) error {
+	watcher, err := c.kv.WatchAll(nats.IgnoreDeletes(), nats.Context(c.ctx))
+	if err != nil {
+		return fmt.Errorf("failed to list kv bucket: %w", err)
+	}
+	defer watcher.Stop()
+	now := time.Now()
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			return nil // marker for the end of the initial values
+		}
+		key := decodeKVKey(entry.Key())
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var env kvEnvelope
+		if err := msgpack.Unmarshal(entry.Value(), &env); err != nil || env.expired(now) {
+			continue
+		}
+		if !fn(key, &env, entry) {
+			return nil
+		}
+	}
+	return c.ctx.Err()
+}
+
+func (c *natsKVCache) Get(key string) (bool, any, error) {
+	if c.local != nil {
+		if val, ok := c.local.Get(key); ok {
+			ttl, _ := c.local.TTL(key)
+			c.hit(key, ttl)
+			return true, val, nil
+		}
+	}
+	env, err := c.read(key)
+	if err != nil || env == nil {
+		c.stats.misses.Add(1)
+		return false, nil, err
+	}
+	if c.local != nil {
+		c.local.Set(key, env.Value, time.Until(time.Unix(0, env.Expires)))
+	}
+	c.hit(key, time.Until(time.Unix(0, env.Expires)))
+	return true, env.Value, nil
+}
+
+// maxTrackedHits is the max number of keys whose hits are counted, the least recently read keys are dropped.
+const maxTrackedHits = 10_000
+
+// hit counts a read of the key, the count is removed when the value expires.
+func (c *natsKVCache) hit(key string, ttl time.Duration) {
+	c.stats.hits.Add(1)
+	c.mutex.Lock()
+	hits, _ := c.hits.Get(key)
+	c.hits.Set(key, hits+1, ttl)
+	c.mutex.Unlock()
+}
+
+// Hits returns the number of times a key has been accessed from this instance.
+func (c *natsKVCache) Hits(key string) (bool, int) {
+	c.mutex.Lock()
+	hits, ok := c.hits.Get(key)
+	c.mutex.Unlock()
+	if !ok {
+		return false, 0
+	}
+	return true, hits
+}
+
+func (c *natsKVCache) TTL(key string) (bool, time.Duration, error) {
+	found, info, err := c.Info(key)
+	return found, info.TTL, err
+}
+
+// Info returns the metadata for a key, hits are the number of times the key has been accessed from this instance.
+func (c *natsKVCache) Info(key string) (bool, KeyInfo, error) {
+	env, entry, err := c.readEntry(key)
+	if err != nil || env == nil {
+		return false, KeyInfo{}, err
+	}
+	_, hits := c.Hits(key)
+	now := time.Now()
+	return true, KeyInfo{
+		Hits: hits,
+		TTL:  time.Unix(0, env.Expires).Sub(now),
+		Age:  now.Sub(entry.Created()),
+	}, nil
+}
+
+// Keys returns the unexpired keys which start with prefix. This reads every value in the bucket.
+func (c *natsKVCache) Keys(prefix string) ([]string, error) {
+	var keys []string
+	err := c.scan(prefix, func(key string, _ *kvEnvelope, _ nats.KeyValueEntry) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Len returns the number of unexpired entries in the bucket. This reads every value in the bucket.
+func (c *natsKVCache) Len() (int, error) {
+	var count int
+	err := c.scan("", func(string, *kvEnvelope, nats.KeyValueEntry) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// Range calls fn for each unexpired entry in the bucket until fn returns false.
+func (c *natsKVCache) Range(fn func(key string, val any) bool) error {
+	return c.scan("", func(key string, env *kvEnvelope, _ nats.KeyValueEntry) bool {
+		return fn(key, env.Value)
+	})
+}
+
+func (c *natsKVCache) GetMany(keys []string) (map[string]any, error) {
+	vals := make(map[string]any, len(keys))
+	for _, key := range keys {
+		found, val, err := c.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			vals[key] = val
+		}
+	}
+	return vals, nil
+}
+
+func (c *natsKVCache) SetMany(vals map[string]any, expires time.Duration) error {
+	for key, val := range vals {
+		if err := c.Set(key, val, expires); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *natsKVCache) Set(key string, val any, expires time.Duration) error {
+	buf, err := msgpack.Marshal(&kvEnvelope{
+		Value:   val,
+		Expires: time.Now().Add(expires).UnixNano(),
+		Origin:  c.origin,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s for kv: %w", key, err)
+	}
+	if _, err := c.kv.Put(encodeKVKey(key), buf); err != nil {
+		return fmt.Errorf("failed to put %s into kv: %w", key, err)
+	}
+	if c.local != nil {
+		c.local.Set(key, val, expires)
+	}
+	return nil
+}
+
+func (c *natsKVCache) GetOrLoad(ctx context.Context, key string, loader Loader, expires time.Duration) (any, error) {
+	found, val, err := c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return val, nil
+	}
+	return c.flights.do(ctx, key, func() (any, error) {
+		// the load is shared by every caller waiting for the key so it isn't cancelled with the first caller
+		val, err := loader(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Set(key, val, expires); err != nil {
+			return nil, err
+		}
+		return val, nil
+	})
+}
+
+func (c *natsKVCache) Expire(key string) (bool, error) {
+	if c.local != nil {
+		c.local.Expire(key)
+	}
+	c.mutex.Lock()
+	c.hits.Expire(key)
+	c.mutex.Unlock()
+	env, err := c.read(key)
+	if err != nil {
+		return false, err
+	}
+	if env == nil {
+		return false, nil
+	}
+	if err := c.kv.Delete(encodeKVKey(key)); err != nil {
+		return false, fmt.Errorf("failed to delete %s from kv: %w", key, err)
+	}
+	return true, nil
+}
+
+func (c *natsKVCache) ExpireMany(keys []string) (int, error) {
+	var count int
+	for _, key := range keys {
+		found, err := c.Expire(key)
+		if err != nil {
+			return count, err
+		}
+		if found {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ExpirePrefix will expire all keys which start with prefix. This reads every value in the bucket.
+func (c *natsKVCache) ExpirePrefix(prefix string) (int, error) {
+	keys, err := c.Keys(prefix)
+	if err != nil {
+		return 0, err
+	}
+	return c.ExpireMany(keys)
+}
+
+// Stats returns the statistics for this instance.
+func (c *natsKVCache) Stats() Stats {
+	return Stats{
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		Expirations: c.stats.expirations.Load(),
+	}
+}
+
+func (c *natsKVCache) Close() error {
+	c.once.Do(func() {
+		c.cancel()
+		if c.watcher != nil {
+			c.watcher.Stop()
+		}
+		c.waitGroup.Wait()
+		c.hits.Close()
+		if c.local != nil {
+			c.local.Close()
+		}
+	})
+	return nil
+}
+
+// watch invalidates local entries when they are changed by another instance.
+func (c *natsKVCache) watch() {
+	defer c.waitGroup.Done()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case entry, ok := <-c.watcher.Updates():
+			if !ok {
+				return
+			}
+			if entry == nil {
+				continue // marker for the end of the initial values
+			}
+			key := decodeKVKey(entry.Key())
+			if entry.Operation() == nats.KeyValuePut {
+				var env kvEnvelope
+				if err := msgpack.Unmarshal(entry.Value(), &env); err == nil && env.Origin == c.origin {
+					continue // our own write, the local tier is already up to date
+				}
+			}
+			c.local.Expire(key)
+		}
+	}
+}
+
+type natsKVOpts struct {
+	bucketTTL   time.Duration
+	replicas    int
+	local       bool
+	localConfig TypedConfig[string, any]
+}
+
+type NatsKVOpt func(opts *natsKVOpts)
+
+// WithBucketTTL sets the max age of values in the bucket when the bucket is created.
+// Expired values are removed when they are read so this is the upper bound for values which are never read again.
+func WithBucketTTL(ttl time.Duration) NatsKVOpt {
+	return func(opts *natsKVOpts) {
+		opts.bucketTTL = ttl
+	}
+}
+
+// WithBucketReplicas sets the number of replicas for the bucket when the bucket is created.
+func WithBucketReplicas(replicas int) NatsKVOpt {
+	return func(opts *natsKVOpts) {
+		opts.replicas = replicas
+	}
+}
+
+// WithLocalTier adds an in-memory cache in front of the KV bucket which holds up to maxEntries (0 is unbounded).
+// Local entries are invalidated when the key is changed or deleted by another instance.
+func WithLocalTier(maxEntries int) NatsKVOpt {
+	return func(opts *natsKVOpts) {
+		opts.local = true
+		opts.localConfig.MaxEntries = maxEntries
+	}
+}
+
+// NewNatsKV returns a new Cache implementation backed by a JetStream KV bucket, creating the bucket if it doesn't exist.
+// Errors which can't be returned are logged with the logger from the parent context (see logger.WithContext).
+// Values are serialized with msgpack so values read back from the bucket are decoded into generic types
+// (for example a struct is returned as a map[string]any).
+func NewNatsKV(parent context.Context, js nats.JetStreamContext, bucket string, opts ...NatsKVOpt) (Cache, error) {
+	var config natsKVOpts
+	for _, opt := range opts {
+		opt(&config)
+	}
+	kv, err := js.KeyValue(bucket)
+	if err != nil {
+		if !errors.Is(err, nats.ErrBucketNotFound) {
+			return nil, fmt.Errorf("failed to get kv bucket %s: %w", bucket, err)
+		}
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "cache",
+			History:     1,
+			TTL:         config.bucketTTL,
+			Replicas:    config.replicas,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kv bucket %s: %w", bucket, err)
+		}
+	}
+	origin, err := cstring.GenerateRandomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate origin id: %w", err)
+	}
+	ctx, cancel := context.WithCancel(parent)
+	c := &natsKVCache{
+		ctx:    ctx,
+		cancel: cancel,
+		kv:     kv,
+		origin: origin,
+		hits:   NewTyped(ctx, TypedConfig[string, int]{MaxEntries: maxTrackedHits, ExpiryCheck: time.Minute}),
+	}
+	if config.local {
+		watcher, err := kv.WatchAll(nats.UpdatesOnly(), nats.Context(ctx))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to watch kv bucket %s: %w", bucket, err)
+		}
+		config.localConfig.ExpiryCheck = time.Minute
+		c.local = NewTyped(ctx, config.localConfig)
+		c.watcher = watcher
+		c.waitGroup.Add(1)
+		go c.watch()
+	}
+	return c, nil
+}
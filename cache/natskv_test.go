@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func runTestServer(t *testing.T) (*server.Server, nats.JetStreamContext) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = 8224
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opts)
+	nc, err := nats.Connect("nats://localhost:8224")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		nc.Close()
+		srv.Shutdown()
+	})
+	js, err := nc.JetStream()
+	assert.NoError(t, err)
+	return srv, js
+}
+
+func TestKVKeyEncoding(t *testing.T) {
+	assert.Equal(t, "dns=3Aapp=2Eshopmonkey=2Ecloud", encodeKVKey("dns:app.shopmonkey.cloud"))
+	assert.Equal(t, "dns:app.shopmonkey.cloud", decodeKVKey(encodeKVKey("dns:app.shopmonkey.cloud")))
+	assert.Equal(t, "a=3Db", encodeKVKey("a=b"))
+	assert.Equal(t, "a=b", decodeKVKey(encodeKVKey("a=b")))
+	assert.Equal(t, "simple-key_1/2", encodeKVKey("simple-key_1/2"))
+}
+
+func TestNatsKVSetGet(t *testing.T) {
+	_, js := runTestServer(t)
+	c, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer c.Close()
+	found, val, err := c.Get("test:key")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Nil(t, val)
+	assert.NoError(t, c.Set("test:key", map[string]any{"foo": "bar"}, time.Minute))
+	found, val, err = c.Get("test:key")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]any{"foo": "bar"}, val)
+	ok, hits := c.Hits("test:key")
+	assert.True(t, ok)
+	assert.Equal(t, 1, hits)
+	ok, err = c.Expire("test:key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	found, _, err = c.Get("test:key")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	ok, err = c.Expire("test:key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestNatsKVExpires(t *testing.T) {
+	_, js := runTestServer(t)
+	c, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.NoError(t, c.Set("test", "value", time.Millisecond*50))
+	found, _, err := c.Get("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	ok, _ := c.Hits("test")
+	assert.True(t, ok)
+	time.Sleep(time.Millisecond * 60)
+	found, _, err = c.Get("test")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	ok, _ = c.Hits("test")
+	assert.False(t, ok, "hits should expire with the value")
+}
+
+func TestNatsKVSharedBetweenInstances(t *testing.T) {
+	_, js := runTestServer(t)
+	a, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer b.Close()
+	assert.NoError(t, a.Set("test", "value", time.Minute))
+	found, val, err := b.Get("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "value", val)
+	var calls int
+	val, err = b.GetOrLoad(context.Background(), "loaded", func(ctx context.Context) (any, error) {
+		calls++
+		return "loaded value", nil
+	}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded value", val)
+	val, err = a.GetOrLoad(context.Background(), "loaded", func(ctx context.Context) (any, error) {
+		calls++
+		return "other value", nil
+	}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded value", val)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNatsKVLocalTierInvalidation(t *testing.T) {
+	_, js := runTestServer(t)
+	a, err := NewNatsKV(context.Background(), js, "cache", WithLocalTier(100))
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := NewNatsKV(context.Background(), js, "cache", WithLocalTier(100))
+	assert.NoError(t, err)
+	defer b.Close()
+	assert.NoError(t, a.Set("test", "one", time.Minute))
+	found, val, err := b.Get("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "one", val)
+	_, ok := b.(*natsKVCache).local.Get("test")
+	assert.True(t, ok, "value should be in the local tier")
+
+	assert.NoError(t, a.Set("test", "two", time.Minute))
+	assert.Eventually(t, func() bool {
+		_, ok := b.(*natsKVCache).local.Get("test")
+		return !ok
+	}, time.Second, time.Millisecond*10, "local tier should be invalidated by the remote write")
+	found, val, err = b.Get("test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "two", val)
+
+	_, err = a.Expire("test")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		found, _, _ := b.Get("test")
+		return !found
+	}, time.Second, time.Millisecond*10, "local tier should be invalidated by the remote delete")
+
+	// our own writes shouldn't invalidate our local tier
+	assert.NoError(t, a.Set("mine", "value", time.Minute))
+	time.Sleep(time.Millisecond * 50)
+	_, ok = a.(*natsKVCache).local.Get("mine")
+	assert.True(t, ok)
+}
+
+func TestNatsKVIntrospection(t *testing.T) {
+	_, js := runTestServer(t)
+	c, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer c.Close()
+	count, err := c.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.NoError(t, c.SetMany(map[string]any{"dns:a": "1", "dns:b": "2", "schema:a": "3"}, time.Minute))
+	assert.NoError(t, c.Set("dns:expired", "4", time.Millisecond))
+	time.Sleep(time.Millisecond * 2)
+	keys, err := c.Keys("dns:")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"dns:a", "dns:b"}, keys)
+	count, err = c.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	vals, err := c.GetMany([]string{"dns:a", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"dns:a": "1"}, vals)
+	found, info, err := c.Info("dns:a")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, info.Hits)
+	assert.Greater(t, info.TTL, time.Second*59)
+	assert.Equal(t, Stats{Hits: 1, Misses: 1}, c.Stats())
+	n, err := c.ExpirePrefix("dns:")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	keys, err = c.Keys("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"schema:a"}, keys)
+}
+
+func TestNatsKVExpiredDeleteKeepsNewerValue(t *testing.T) {
+	_, js := runTestServer(t)
+	c, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer c.Close()
+	kv := c.(*natsKVCache).kv
+	rev, err := kv.Put("test", []byte("old"))
+	assert.NoError(t, err)
+	_, err = kv.Put("test", []byte("new"))
+	assert.NoError(t, err)
+	err = kv.Delete("test", nats.LastRevision(rev))
+	assert.True(t, isWrongLastSequence(err))
+	entry, err := kv.Get("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(entry.Value()))
+}
+
+func TestNatsKVGetOrLoadOutlivesCancelledCaller(t *testing.T) {
+	_, js := runTestServer(t)
+	c, err := NewNatsKV(context.Background(), js, "cache")
+	assert.NoError(t, err)
+	defer c.Close()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(ctx, "test", func(ctx context.Context) (any, error) {
+			close(started)
+			select {
+			case <-release:
+				return "value", nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}, time.Minute)
+		errs <- err
+	}()
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	close(release)
+	assert.Eventually(t, func() bool {
+		found, val, err := c.Get("test")
+		return err == nil && found && val == "value"
+	}, time.Second, time.Millisecond*10, "the load should finish after the caller is cancelled")
+}
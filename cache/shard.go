@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lfuSampleSize is the number of least recently used entries considered when picking an LFU victim.
+const lfuSampleSize = 5
+
+type typedEntry[K comparable, V any] struct {
+	key     K
+	hash    uint64
+	object  V
+	expires time.Time
+	updated time.Time // when the value was last set
+	hits    int
+	cost    int64
+	err     error // set for negative entries caching a loader error
+	element *list.Element
+	index   int // index in the expiry heap
+}
+
+// lookupState is the state of an entry found by lookup.
+type lookupState int
+
+const (
+	lookupMissing lookupState = iota
+	lookupFresh
+	lookupStale
+)
+
+type eviction[K comparable, V any] struct {
+	key    K
+	object V
+	reason EvictionReason
+}
+
+// expiryHeap is a min heap of entries ordered by expiration so expired entries can be removed
+// without scanning every entry in the shard.
+type expiryHeap[K comparable, V any] []*typedEntry[K, V]
+
+func (h expiryHeap[K, V]) Len() int           { return len(h) }
+func (h expiryHeap[K, V]) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap[K, V]) Push(x any) {
+	entry := x.(*typedEntry[K, V])
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
+
+// shard is an independently locked partition of a TypedCache.
+type shard[K comparable, V any] struct {
+	mutex      sync.Mutex
+	policy     EvictionPolicy
+	maxEntries int
+	maxCost    int64
+	stale      time.Duration // how long expired entries are kept to be served while revalidating
+	cost       int64
+	entries    map[K]*typedEntry[K, V]
+	order      *list.List // front is the most recently used
+	expiry     expiryHeap[K, V]
+	sketch     *countMinSketch
+}
+
+func (s *shard[K, V]) get(key K, hash uint64, now time.Time) (V, bool, []eviction[K, V]) {
+	val, err, state, evicted := s.lookup(key, hash, now)
+	if state != lookupFresh || err != nil {
+		var empty V
+		return empty, false, evicted
+	}
+	return val, true, evicted
+}
+
+// lookup returns the entry value (or cached loader error) and whether the entry is fresh or stale.
+func (s *shard[K, V]) lookup(key K, hash uint64, now time.Time) (V, error, lookupState, []eviction[K, V]) {
+	var val V
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.sketch != nil {
+		s.sketch.Increment(hash)
+	}
+	entry, ok := s.entries[key]
+	if !ok {
+		return val, nil, lookupMissing, nil
+	}
+	if entry.expires.Before(now) {
+		if entry.err == nil && entry.expires.Add(s.stale).After(now) {
+			return entry.object, nil, lookupStale, nil
+		}
+		s.remove(entry)
+		return val, nil, lookupMissing, []eviction[K, V]{{entry.key, entry.object, EvictionReasonExpired}}
+	}
+	if entry.err == nil {
+		entry.hits++
+		s.order.MoveToFront(entry.element)
+	}
+	return entry.object, entry.err, lookupFresh, nil
+}
+
+func (s *shard[K, V]) set(key K, hash uint64, val V, err error, cost int64, expires time.Time) (bool, []eviction[K, V]) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.maxCost > 0 && cost > s.maxCost {
+		evicted := []eviction[K, V]{{key, val, EvictionReasonRejected}}
+		// remove the old value so it isn't returned after the new value was rejected
+		if entry, ok := s.entries[key]; ok {
+			s.remove(entry)
+			evicted = append(evicted, eviction[K, V]{entry.key, entry.object, EvictionReasonCapacity})
+		}
+		return false, evicted
+	}
+	if s.sketch != nil {
+		s.sketch.Increment(hash)
+	}
+	if entry, ok := s.entries[key]; ok {
+		s.cost += cost - entry.cost
+		entry.expires = expires
+		entry.updated = time.Now()
+		entry.object = val
+		entry.err = err
+		entry.cost = cost
+		s.order.MoveToFront(entry.element)
+		heap.Fix(&s.expiry, entry.index)
+		return true, s.evict(entry)
+	}
+	entry := &typedEntry[K, V]{key: key, hash: hash, object: val, err: err, expires: expires, updated: time.Now(), cost: cost}
+	if s.sketch != nil && s.overCapacity(1, cost) {
+		if victim := s.victim(nil); victim != nil && s.sketch.Estimate(hash) < s.sketch.Estimate(victim.hash) {
+			return false, []eviction[K, V]{{key, val, EvictionReasonRejected}}
+		}
+	}
+	entry.element = s.order.PushFront(entry)
+	heap.Push(&s.expiry, entry)
+	s.entries[key] = entry
+	s.cost += cost
+	return true, s.evict(entry)
+}
+
+func (s *shard[K, V]) hitCount(key K) (bool, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		return true, entry.hits
+	}
+	return false, 0
+}
+
+func (s *shard[K, V]) info(key K, now time.Time) (KeyInfo, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || entry.err != nil || !entry.expires.After(now) {
+		return KeyInfo{}, false
+	}
+	return KeyInfo{Hits: entry.hits, TTL: entry.expires.Sub(now), Age: now.Sub(entry.updated), Cost: entry.cost}, true
+}
+
+func (s *shard[K, V]) setHits(key K, hits int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		entry.hits = hits
+	}
+}
+
+// snapshot returns a copy of the unexpired entries, negative entries are skipped.
+func (s *shard[K, V]) snapshot(now time.Time) []snapshotEntry[K, V] {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := make([]snapshotEntry[K, V], 0, len(s.entries))
+	for _, entry := range s.entries {
+		if entry.err != nil || !entry.expires.After(now) {
+			continue
+		}
+		entries = append(entries, snapshotEntry[K, V]{entry.key, entry.object, entry.expires, entry.hits})
+	}
+	return entries
+}
+
+func (s *shard[K, V]) expire(key K) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[key]
+	if ok {
+		s.remove(entry)
+	}
+	return ok
+}
+
+func (s *shard[K, V]) len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries)
+}
+
+func (s *shard[K, V]) totalCost() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cost
+}
+
+// removeExpired pops expired entries (past the stale window) off the expiry heap which is O(log n) for each expired entry.
+func (s *shard[K, V]) removeExpired(now time.Time) []eviction[K, V] {
+	var evicted []eviction[K, V]
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for len(s.expiry) > 0 && s.expiry[0].expires.Add(s.stale).Before(now) {
+		entry := s.expiry[0]
+		s.remove(entry)
+		evicted = append(evicted, eviction[K, V]{entry.key, entry.object, EvictionReasonExpired})
+	}
+	return evicted
+}
+
+func (s *shard[K, V]) overCapacity(entries int, cost int64) bool {
+	if s.maxEntries > 0 && len(s.entries)+entries > s.maxEntries {
+		return true
+	}
+	if s.maxCost > 0 && s.cost+cost > s.maxCost {
+		return true
+	}
+	return false
+}
+
+// victim returns the next entry to evict, skipping keep. must be called with the lock held.
+func (s *shard[K, V]) victim(keep *typedEntry[K, V]) *typedEntry[K, V] {
+	var victim *typedEntry[K, V]
+	var count int
+	for el := s.order.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*typedEntry[K, V])
+		if entry == keep {
+			continue
+		}
+		if s.policy != LFU {
+			return entry
+		}
+		if victim == nil || s.sketch.Estimate(entry.hash) < s.sketch.Estimate(victim.hash) {
+			victim = entry
+		}
+		count++
+		if count >= lfuSampleSize {
+			break
+		}
+	}
+	return victim
+}
+
+// evict removes entries until the shard is within capacity. must be called with the lock held.
+func (s *shard[K, V]) evict(keep *typedEntry[K, V]) []eviction[K, V] {
+	var evicted []eviction[K, V]
+	for s.overCapacity(0, 0) {
+		victim := s.victim(keep)
+		if victim == nil {
+			break
+		}
+		s.remove(victim)
+		evicted = append(evicted, eviction[K, V]{victim.key, victim.object, EvictionReasonCapacity})
+	}
+	return evicted
+}
+
+// remove the entry from the shard. must be called with the lock held.
+func (s *shard[K, V]) remove(entry *typedEntry[K, V]) {
+	delete(s.entries, entry.key)
+	s.order.Remove(entry.element)
+	if entry.index >= 0 {
+		heap.Remove(&s.expiry, entry.index)
+	}
+	s.cost -= entry.cost
+}
+
+func newShard[K comparable, V any](policy EvictionPolicy, maxEntries int, maxCost int64, stale time.Duration) *shard[K, V] {
+	s := &shard[K, V]{
+		policy:     policy,
+		maxEntries: maxEntries,
+		maxCost:    maxCost,
+		stale:      stale,
+		entries:    make(map[K]*typedEntry[K, V]),
+		order:      list.New(),
+	}
+	if policy == LFU {
+		s.sketch = newCountMinSketch(maxEntries)
+	}
+	return s
+}
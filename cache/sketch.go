@@ -0,0 +1,73 @@
+package cache
+
+const (
+	sketchDepth    = 4
+	sketchMaxCount = 15
+)
+
+// countMinSketch is a frequency estimator used by the LFU eviction policy to decide
+// which entries are worth keeping (modeled after TinyLFU). Counters are periodically
+// halved so that the frequencies reflect recent history.
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 64
+	for width < capacity*4 {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		resetAt: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(hash uint64, row int) uint64 {
+	h := hash>>(row*16) | hash<<(64-row*16)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h & s.mask
+}
+
+// Increment records an access for the hash.
+func (s *countMinSketch) Increment(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+// Estimate returns the estimated access frequency for the hash.
+func (s *countMinSketch) Estimate(hash uint64) uint8 {
+	min := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(hash, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
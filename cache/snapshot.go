@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// Snapshotter is implemented by caches which can be saved to and restored from a snapshot.
+type Snapshotter interface {
+	// Snapshot writes the unexpired entries in the cache to w.
+	Snapshot(w io.Writer) error
+	// Restore reads a snapshot written by Snapshot from r into the cache, skipping entries which have since expired.
+	Restore(r io.Reader) error
+}
+
+type snapshotHeader struct {
+	Version int
+	Created time.Time
+}
+
+// snapshotRecord is a single entry in a snapshot. The key and value are gob encoded separately into Data so that
+// a value which can't be encoded (for example an unregistered type stored in an any) is skipped instead of failing
+// the whole snapshot.
+type snapshotRecord struct {
+	Data []byte
+	TTL  time.Duration // remaining TTL when the snapshot was created
+	Hits int
+}
+
+type snapshotItem[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	key     K
+	object  V
+	expires time.Time
+	hits    int
+}
+
+// Snapshot writes the unexpired entries in the cache to w using gob encoding. Values stored as interfaces must have
+// their concrete types registered with gob.Register, entries which can't be encoded are skipped.
+func (c *TypedCache[K, V]) Snapshot(w io.Writer) error {
+	now := time.Now()
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion, Created: now}); err != nil {
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	var buf bytes.Buffer
+	for _, s := range c.shards {
+		for _, entry := range s.snapshot(now) {
+			buf.Reset()
+			if err := gob.NewEncoder(&buf).Encode(snapshotItem[K, V]{entry.key, entry.object}); err != nil {
+				continue
+			}
+			record := snapshotRecord{Data: buf.Bytes(), TTL: entry.expires.Sub(now), Hits: entry.hits}
+			if err := enc.Encode(record); err != nil {
+				return fmt.Errorf("failed to write snapshot entry: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore reads a snapshot written by Snapshot into the cache. Entries which expired since the snapshot was
+// created are discarded.
+func (c *TypedCache[K, V]) Restore(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version: %d", header.Version)
+	}
+	elapsed := time.Since(header.Created)
+	for {
+		var record snapshotRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read snapshot entry: %w", err)
+		}
+		ttl := record.TTL - elapsed
+		if ttl <= 0 {
+			continue
+		}
+		var item snapshotItem[K, V]
+		if err := gob.NewDecoder(bytes.NewReader(record.Data)).Decode(&item); err != nil {
+			continue
+		}
+		if c.Set(item.Key, item.Value, ttl) {
+			s, _ := c.shard(item.Key)
+			s.setHits(item.Key, record.Hits)
+		}
+	}
+}
+
+// writeSnapshotFile writes a snapshot to a temporary file and renames it to filename so that
+// a partially written snapshot is never restored.
+func writeSnapshotFile(s Snapshotter, filename string) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := s.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync snapshot file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("failed to rename snapshot file: %w", err)
+	}
+	return nil
+}
+
+// readSnapshotFile restores a snapshot from filename if it exists.
+func readSnapshotFile(s Snapshotter, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open snapshot file: %w", err)
+	}
+	defer f.Close()
+	return s.Restore(f)
+}
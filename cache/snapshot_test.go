@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type unregistered struct {
+	Name string
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	c := NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	assert.NoError(t, c.Set("string", "value", time.Minute))
+	assert.NoError(t, c.Set("int", 42, time.Minute))
+	assert.NoError(t, c.Set("slice", []string{"a", "b"}, time.Minute))
+	assert.NoError(t, c.Set("short", "value", time.Millisecond*20))
+	assert.NoError(t, c.Set("custom", unregistered{"skip"}, time.Minute))
+	c.Get("string")
+	c.Get("string")
+
+	var buf bytes.Buffer
+	assert.NoError(t, c.(Snapshotter).Snapshot(&buf))
+
+	time.Sleep(time.Millisecond * 25)
+	restored := NewInMemory(context.Background(), time.Minute)
+	defer restored.Close()
+	assert.NoError(t, restored.(Snapshotter).Restore(&buf))
+
+	found, val, _ := restored.Get("string")
+	assert.True(t, found)
+	assert.Equal(t, "value", val)
+	ok, hits := restored.Hits("string")
+	assert.True(t, ok)
+	assert.Equal(t, 3, hits)
+	found, val, _ = restored.Get("int")
+	assert.True(t, found)
+	assert.Equal(t, 42, val)
+	found, val, _ = restored.Get("slice")
+	assert.True(t, found)
+	assert.Equal(t, []string{"a", "b"}, val)
+	found, _, _ = restored.Get("short")
+	assert.False(t, found, "entries which expired since the snapshot should be discarded")
+	found, _, _ = restored.Get("custom")
+	assert.False(t, found, "entries which can't be encoded should be skipped")
+}
+
+func TestSnapshotKeepsRemainingTTL(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	c.Set("test", 1, time.Millisecond*50)
+	var buf bytes.Buffer
+	assert.NoError(t, c.Snapshot(&buf))
+	restored := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer restored.Close()
+	assert.NoError(t, restored.Restore(&buf))
+	val, ok := restored.Get("test")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+	time.Sleep(time.Millisecond * 55)
+	_, ok = restored.Get("test")
+	assert.False(t, ok)
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	assert.Error(t, c.Restore(bytes.NewReader([]byte("not a snapshot"))))
+}
+
+func TestSnapshotFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := NewInMemory(context.Background(), time.Minute, WithSnapshotFile(filename, time.Millisecond*10))
+	assert.NoError(t, c.Set("test", "value", time.Minute))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filename)
+		return err == nil
+	}, time.Second, time.Millisecond*10)
+	assert.NoError(t, c.Set("final", "value", time.Minute))
+	assert.NoError(t, c.Close())
+
+	files, err := os.ReadDir(filepath.Dir(filename))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files should be removed")
+
+	restored := NewInMemory(context.Background(), time.Minute, WithSnapshotFile(filename, 0))
+	defer restored.Close()
+	found, val, _ := restored.Get("test")
+	assert.True(t, found)
+	assert.Equal(t, "value", val)
+	found, _, _ = restored.Get("final")
+	assert.True(t, found, "a snapshot should be written on close")
+}
+
+func TestSnapshotFileLogsErrors(t *testing.T) {
+	log := logger.NewTestLogger()
+	filename := filepath.Join(t.TempDir(), "missing", "cache.snapshot")
+	c := NewInMemory(logger.WithContext(context.Background(), log), time.Minute, WithSnapshotFile(filename, time.Millisecond*10))
+	time.Sleep(time.Millisecond * 50)
+	assert.Error(t, c.Close())
+	assert.NotEmpty(t, log.Logs, "periodic snapshot errors should be logged")
+	assert.Equal(t, "WARNING", log.Logs[0].Severity)
+}
+
+func TestSnapshotFileLogsReadErrors(t *testing.T) {
+	log := logger.NewTestLogger()
+	filename := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := NewInMemory(logger.WithContext(context.Background(), log), time.Minute, WithSnapshotFile(filename, 0))
+	assert.NoError(t, c.Close())
+	assert.Empty(t, log.Logs, "a missing snapshot shouldn't be logged")
+
+	assert.NoError(t, os.WriteFile(filename, []byte("not a snapshot"), 0600))
+	c = NewInMemory(logger.WithContext(context.Background(), log), time.Minute, WithSnapshotFile(filename, 0))
+	defer c.Close()
+	assert.Len(t, log.Logs, 1)
+	assert.Equal(t, "WARNING", log.Logs[0].Severity)
+}
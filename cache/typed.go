@@ -0,0 +1,300 @@
+package cache
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy controls which entry is removed when a TypedCache is over capacity.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used entry using a TinyLFU style frequency sketch
+	// and only admits new entries which are accessed at least as often as the entry they replace.
+	LFU
+)
+
+// EvictionReason describes why an entry was removed from a TypedCache.
+type EvictionReason int
+
+const (
+	// EvictionReasonCapacity is when the entry was removed to make room for another entry.
+	EvictionReasonCapacity EvictionReason = iota
+	// EvictionReasonExpired is when the entry was removed because it expired.
+	EvictionReasonExpired
+	// EvictionReasonRejected is when a new entry was not admitted by the LFU policy.
+	EvictionReasonRejected
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionReasonCapacity:
+		return "capacity"
+	case EvictionReasonExpired:
+		return "expired"
+	case EvictionReasonRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats are the statistics for a TypedCache.
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+// TypedConfig is the configuration for a TypedCache.
+type TypedConfig[K comparable, V any] struct {
+	// MaxEntries is the maximum number of entries in the cache, 0 is unbounded.
+	MaxEntries int
+	// MaxCost is the maximum total cost of the entries in the cache, 0 is unbounded.
+	MaxCost int64
+	// Cost returns the cost of an entry, defaults to 1 for each entry.
+	Cost func(key K, val V) int64
+	// Policy is the eviction policy used when the cache is over capacity, defaults to LRU.
+	Policy EvictionPolicy
+	// OnEvict is called (outside any lock) when an entry is evicted or expires.
+	OnEvict func(key K, val V, reason EvictionReason)
+	// ExpiryCheck is the interval for removing expired entries in the background, 0 disables the background check.
+	ExpiryCheck time.Duration
+	// Shards is the number of independently locked partitions of the cache. The MaxEntries and MaxCost bounds
+	// are split evenly between the shards so eviction is approximate when there is more than one shard.
+	// Defaults to 16 for unbounded caches, 1 for caches only bounded by MaxCost and 1 shard per 128 entries
+	// (up to 16) for caches bounded by MaxEntries.
+	Shards int
+	// StaleWhileRevalidate is how long after expiring an entry can still be returned by GetOrLoad
+	// while it is reloaded in the background, 0 disables serving stale entries.
+	StaleWhileRevalidate time.Duration
+	// NegativeTTL is how long a loader error is cached by GetOrLoad, 0 disables caching errors.
+	NegativeTTL time.Duration
+	// Jitter is the fraction (0.0 to 1.0) of the TTL randomly added or removed from entries stored by GetOrLoad
+	// so that entries loaded at the same time don't all expire at the same time. Values above 1 are treated as 1.
+	Jitter float64
+}
+
+const (
+	defaultShards      = 16
+	minEntriesPerShard = 128
+)
+
+// TypedCache is a generic in-memory cache with optional size bounds and eviction.
+// The cache is partitioned into shards which are locked independently to reduce contention.
+type TypedCache[K comparable, V any] struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	config      TypedConfig[K, V]
+	shards      []*shard[K, V]
+	mask        uint64
+	seed        maphash.Seed
+	flights     flightGroup[K, V]
+	waitGroup   sync.WaitGroup
+	closeMutex  sync.Mutex
+	closed      bool
+	once        sync.Once
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+func (c *TypedCache[K, V]) shard(key K) (*shard[K, V], uint64) {
+	hash := maphash.Comparable(c.seed, key)
+	return c.shards[hash&c.mask], hash
+}
+
+// Get a value from the cache and return true if found.
+func (c *TypedCache[K, V]) Get(key K) (V, bool) {
+	s, hash := c.shard(key)
+	val, ok, evicted := s.get(key, hash, time.Now())
+	c.notify(evicted)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return val, ok
+}
+
+// Set a value into the cache with a cache expiration. Returns false if the value was not admitted into the cache.
+func (c *TypedCache[K, V]) Set(key K, val V, expires time.Duration) bool {
+	cost := int64(1)
+	if c.config.Cost != nil {
+		cost = c.config.Cost(key, val)
+	}
+	s, hash := c.shard(key)
+	ok, evicted := s.set(key, hash, val, nil, cost, time.Now().Add(expires))
+	c.notify(evicted)
+	return ok
+}
+
+// Hits returns the number of times a key has been accessed.
+func (c *TypedCache[K, V]) Hits(key K) (bool, int) {
+	s, _ := c.shard(key)
+	return s.hitCount(key)
+}
+
+// TTL returns the time remaining until a key expires.
+func (c *TypedCache[K, V]) TTL(key K) (time.Duration, bool) {
+	info, ok := c.Info(key)
+	return info.TTL, ok
+}
+
+// Info returns the metadata for a key without counting as an access.
+func (c *TypedCache[K, V]) Info(key K) (KeyInfo, bool) {
+	s, _ := c.shard(key)
+	return s.info(key, time.Now())
+}
+
+// Range calls fn for each unexpired entry in the cache until fn returns false. The entries of each shard are
+// copied before fn is called so fn can safely access the cache.
+func (c *TypedCache[K, V]) Range(fn func(key K, val V) bool) {
+	now := time.Now()
+	for _, s := range c.shards {
+		for _, entry := range s.snapshot(now) {
+			if !fn(entry.key, entry.object) {
+				return
+			}
+		}
+	}
+}
+
+// Expire will expire a key in the cache and return true if it was found.
+func (c *TypedCache[K, V]) Expire(key K) bool {
+	s, _ := c.shard(key)
+	return s.expire(key)
+}
+
+// Len returns the number of entries in the cache including expired entries which have not been removed yet.
+func (c *TypedCache[K, V]) Len() int {
+	var count int
+	for _, s := range c.shards {
+		count += s.len()
+	}
+	return count
+}
+
+// Cost returns the total cost of the entries in the cache.
+func (c *TypedCache[K, V]) Cost() int64 {
+	var cost int64
+	for _, s := range c.shards {
+		cost += s.totalCost()
+	}
+	return cost
+}
+
+// Stats returns the cache statistics.
+func (c *TypedCache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// Close will shutdown the cache.
+func (c *TypedCache[K, V]) Close() error {
+	c.once.Do(func() {
+		c.closeMutex.Lock()
+		c.closed = true
+		c.cancel()
+		c.closeMutex.Unlock()
+		c.waitGroup.Wait()
+	})
+	return nil
+}
+
+func (c *TypedCache[K, V]) notify(evicted []eviction[K, V]) {
+	for _, e := range evicted {
+		switch e.reason {
+		case EvictionReasonExpired:
+			c.expirations.Add(1)
+		default:
+			c.evictions.Add(1)
+		}
+		if c.config.OnEvict != nil {
+			c.config.OnEvict(e.key, e.object, e.reason)
+		}
+	}
+}
+
+func (c *TypedCache[K, V]) removeExpired() {
+	now := time.Now()
+	for _, s := range c.shards {
+		c.notify(s.removeExpired(now))
+	}
+}
+
+func (c *TypedCache[K, V]) run() {
+	timer := time.NewTicker(c.config.ExpiryCheck)
+	defer func() {
+		timer.Stop()
+		c.waitGroup.Done()
+	}()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+			c.removeExpired()
+		}
+	}
+}
+
+func shardCount[K comparable, V any](config TypedConfig[K, V]) int {
+	count := config.Shards
+	if count <= 0 {
+		switch {
+		case config.MaxEntries > 0:
+			count = min(max(config.MaxEntries/minEntriesPerShard, 1), defaultShards)
+		case config.MaxCost > 0:
+			count = 1
+		default:
+			count = defaultShards
+		}
+	}
+	// round up to a power of two so we can mask the hash
+	shards := 1
+	for shards < count {
+		shards <<= 1
+	}
+	return shards
+}
+
+func divideBound[T int | int64](bound T, shards int) T {
+	if bound <= 0 {
+		return 0
+	}
+	return max((bound+T(shards)-1)/T(shards), 1)
+}
+
+// NewTyped returns a new generic in-memory cache.
+func NewTyped[K comparable, V any](parent context.Context, config TypedConfig[K, V]) *TypedCache[K, V] {
+	ctx, cancel := context.WithCancel(parent)
+	count := shardCount(config)
+	c := &TypedCache[K, V]{
+		ctx:    ctx,
+		cancel: cancel,
+		config: config,
+		shards: make([]*shard[K, V], count),
+		mask:   uint64(count - 1),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range c.shards {
+		c.shards[i] = newShard[K, V](config.Policy, divideBound(config.MaxEntries, count), divideBound(config.MaxCost, count), config.StaleWhileRevalidate)
+	}
+	if config.ExpiryCheck > 0 {
+		c.waitGroup.Add(1)
+		go c.run()
+	}
+	return c
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type evicted struct {
+	key    string
+	val    int
+	reason EvictionReason
+}
+
+func TestTypedSetGet(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{})
+	defer c.Close()
+	val, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, val)
+	assert.True(t, c.Set("a", 1, time.Minute))
+	val, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+	found, hits := c.Hits("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, hits)
+	assert.True(t, c.Expire("a"))
+	assert.False(t, c.Expire("a"))
+	assert.Equal(t, Stats{Hits: 1, Misses: 1}, c.Stats())
+}
+
+func TestTypedExpiry(t *testing.T) {
+	var evictions []evicted
+	c := NewTyped(context.Background(), TypedConfig[string, int]{
+		OnEvict: func(key string, val int, reason EvictionReason) {
+			evictions = append(evictions, evicted{key, val, reason})
+		},
+	})
+	defer c.Close()
+	c.Set("a", 1, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []evicted{{"a", 1, EvictionReasonExpired}}, evictions)
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+}
+
+func TestTypedBackgroundExpiry(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{ExpiryCheck: time.Millisecond * 10})
+	defer c.Close()
+	c.Set("a", 1, time.Millisecond)
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestTypedLRUMaxEntries(t *testing.T) {
+	var evictions []evicted
+	c := NewTyped(context.Background(), TypedConfig[string, int]{
+		MaxEntries: 2,
+		OnEvict: func(key string, val int, reason EvictionReason) {
+			evictions = append(evictions, evicted{key, val, reason})
+		},
+	})
+	defer c.Close()
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Get("a")
+	c.Set("c", 3, time.Minute)
+	assert.Equal(t, 2, c.Len())
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []evicted{{"b", 2, EvictionReasonCapacity}}, evictions)
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+}
+
+func TestTypedMaxCost(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, string]{
+		MaxCost: 10,
+		Cost: func(key string, val string) int64 {
+			return int64(len(val))
+		},
+	})
+	defer c.Close()
+	assert.True(t, c.Set("a", "aaaa", time.Minute))
+	assert.True(t, c.Set("b", "bbbb", time.Minute))
+	assert.Equal(t, int64(8), c.Cost())
+	assert.True(t, c.Set("c", "cccc", time.Minute))
+	assert.Equal(t, int64(8), c.Cost())
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.False(t, c.Set("d", "ddddddddddd", time.Minute))
+	assert.Equal(t, 2, c.Len())
+	assert.True(t, c.Set("b", "b", time.Minute))
+	assert.Equal(t, int64(5), c.Cost())
+}
+
+func TestTypedOversizedSetRemovesOldValue(t *testing.T) {
+	var evicted []EvictionReason
+	c := NewTyped(context.Background(), TypedConfig[string, string]{
+		MaxCost: 10,
+		Cost: func(key string, val string) int64 {
+			return int64(len(val))
+		},
+		OnEvict: func(key string, val string, reason EvictionReason) {
+			evicted = append(evicted, reason)
+		},
+	})
+	defer c.Close()
+	assert.True(t, c.Set("a", "small", time.Minute))
+	assert.False(t, c.Set("a", "much too large", time.Minute))
+	_, ok := c.Get("a")
+	assert.False(t, ok, "shouldn't return the old value after the new value was rejected")
+	assert.Equal(t, int64(0), c.Cost())
+	assert.Equal(t, []EvictionReason{EvictionReasonRejected, EvictionReasonCapacity}, evicted)
+	assert.Equal(t, uint64(2), c.Stats().Evictions)
+}
+
+func TestTypedLFU(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[string, int]{MaxEntries: 3, Policy: LFU})
+	defer c.Close()
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Set("c", 3, time.Minute)
+	for i := 0; i < 5; i++ {
+		c.Get("a")
+		c.Get("c")
+	}
+	// b is the least frequently used so it should be evicted even though a is older
+	assert.True(t, c.Set("d", 4, time.Minute))
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	// e has never been seen so it shouldn't displace the frequently used entries
+	for i := 0; i < 5; i++ {
+		c.Get("d")
+	}
+	assert.False(t, c.Set("e", 5, time.Minute))
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestTypedLFUScanResistance(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[int, int]{MaxEntries: 10, Policy: LFU})
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		c.Set(i, i, time.Minute)
+		for j := 0; j < 3; j++ {
+			c.Get(i)
+		}
+	}
+	// a scan of keys which are only seen once shouldn't displace the keys which are still in use
+	for i := 100; i < 1000; i++ {
+		c.Set(i, i, time.Minute)
+		c.Get(i % 10)
+	}
+	var found int
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Get(i); ok {
+			found++
+		}
+	}
+	// the sketch is probabilistic so allow for the odd collision
+	assert.GreaterOrEqual(t, found, 8, fmt.Sprintf("expected hot keys to survive scan, found %d", found))
+}
+
+func TestTypedShardCount(t *testing.T) {
+	assert.Equal(t, 16, shardCount(TypedConfig[string, int]{}))
+	assert.Equal(t, 1, shardCount(TypedConfig[string, int]{MaxEntries: 2}))
+	assert.Equal(t, 8, shardCount(TypedConfig[string, int]{MaxEntries: 1000}))
+	assert.Equal(t, 16, shardCount(TypedConfig[string, int]{MaxEntries: 1000000}))
+	assert.Equal(t, 1, shardCount(TypedConfig[string, int]{MaxCost: 1000000}))
+	assert.Equal(t, 4, shardCount(TypedConfig[string, int]{Shards: 3}))
+}
+
+func TestTypedShardedExpiry(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[int, int]{Shards: 4})
+	defer c.Close()
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			c.Set(i, i, time.Millisecond)
+		} else {
+			c.Set(i, i, time.Minute)
+		}
+	}
+	// extending the expiry of an existing key should move it in the expiry heap
+	c.Set(0, 0, time.Minute)
+	assert.Equal(t, 100, c.Len())
+	time.Sleep(time.Millisecond * 5)
+	c.removeExpired()
+	assert.Equal(t, 51, c.Len())
+	_, ok := c.Get(0)
+	assert.True(t, ok)
+	_, ok = c.Get(2)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(49), c.Stats().Expirations)
+}
+
+func TestTypedConcurrentAccess(t *testing.T) {
+	c := NewTyped(context.Background(), TypedConfig[int, int]{MaxEntries: 1000, ExpiryCheck: time.Millisecond})
+	defer c.Close()
+	done := make(chan bool)
+	for w := 0; w < 8; w++ {
+		go func(w int) {
+			for i := 0; i < 2000; i++ {
+				c.Set(i+w, i, time.Millisecond*time.Duration(i%5))
+				c.Get(i)
+				c.Hits(i)
+				if i%10 == 0 {
+					c.Expire(i)
+				}
+			}
+			done <- true
+		}(w)
+	}
+	for w := 0; w < 8; w++ {
+		<-done
+	}
+	assert.LessOrEqual(t, c.Len(), 1000+8)
+}
@@ -2,13 +2,14 @@ package dns
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/gob"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
-	"net/http"
-	"net/url"
-	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/shopmonkeyus/go-common/cache"
@@ -16,9 +17,43 @@ import (
 
 var ErrInvalidIP = fmt.Errorf("invalid ip address resolved for hostname")
 
+func init() {
+	// register the cached value types so lookups can be included in cache snapshots
+	gob.Register(cachedAddresses{})
+	gob.Register([]net.IP{})
+}
+
+// cachedAddresses is the cached value for a hostname. With WithServeStale the value is cached for the serve
+// stale window after it expires so the stale addresses are kept in the same entry.
+type cachedAddresses struct {
+	IPs     []net.IP
+	Updated time.Time
+	Expires time.Time
+}
+
+// toCachedAddresses returns the cached addresses for a value from the cache. Values cached as []net.IP
+// are fresh until the cache removes them.
+func toCachedAddresses(val any) (cachedAddresses, bool) {
+	switch v := val.(type) {
+	case cachedAddresses:
+		return v, len(v.IPs) > 0
+	case []net.IP:
+		return cachedAddresses{IPs: v}, len(v) > 0
+	}
+	return cachedAddresses{}, false
+}
+
+// fresh returns true if the addresses haven't expired.
+func (c cachedAddresses) fresh(now time.Time) bool {
+	return c.Expires.IsZero() || now.Before(c.Expires)
+}
+
 type DNS interface {
-	// Lookup performs a DNS lookup for the given hostname and returns a valid IP address for the A record.
+	// Lookup performs a DNS lookup for the given hostname and returns a valid IP address in the preferred address family.
 	Lookup(ctx context.Context, hostname string) (bool, *net.IP, error)
+
+	// LookupAll performs a DNS lookup for the given hostname and returns every valid IP address ordered by the family preference.
+	LookupAll(ctx context.Context, hostname string) ([]net.IP, error)
 }
 
 type RecordType uint8
@@ -26,6 +61,21 @@ type RecordType uint8
 const (
 	A     RecordType = 1
 	CNAME RecordType = 5
+	SOA   RecordType = 6
+	AAAA  RecordType = 28
+)
+
+// FamilyPreference controls the order of the addresses returned by LookupAll.
+type FamilyPreference int
+
+const (
+	// PreferIPv4 returns IPv4 addresses before IPv6 addresses.
+	PreferIPv4 FamilyPreference = iota
+	// PreferIPv6 returns IPv6 addresses before IPv4 addresses.
+	PreferIPv6
+	// HappyEyeballs interleaves IPv6 and IPv4 addresses starting with IPv6 and doesn't wait
+	// more than 50ms for AAAA records once the A records are resolved (RFC 8305).
+	HappyEyeballs
 )
 
 type StatusType uint8
@@ -62,8 +112,9 @@ func (s StatusType) String() string {
 }
 
 type Result struct {
-	Status StatusType `json:"Status"`
-	Answer []Answer   `json:"Answer"`
+	Status    StatusType `json:"Status"`
+	Answer    []Answer   `json:"Answer"`
+	Authority []Answer   `json:"Authority"`
 }
 
 type Answer struct {
@@ -75,113 +126,445 @@ type Answer struct {
 
 type dnsConfig struct {
 	FailIfLocal bool
+	Resolvers   []Resolver
+	Family      FamilyPreference
+	Guard       *Guard
+	NegativeTTL time.Duration
+	ServeStale  time.Duration
+	MinTTL      time.Duration
+	Prefetch    int
+	Observer    Observer
 }
 
 type Dns struct {
-	cache   cache.Cache
-	isLocal bool
+	cache       cache.Cache
+	isLocal     bool
+	resolver    Resolver
+	family      FamilyPreference
+	guard       *Guard
+	negativeTTL time.Duration
+	serveStale  time.Duration
+	minTTL      time.Duration
+	prefetch    int
+	observer    Observer
+	prefetching map[string]bool
+	mutex       sync.Mutex
 }
 
 var _ DNS = (*Dns)(nil)
 
-var ipv4 = regexp.MustCompile(`^(((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)(\.|$)){4})`)
-var magicIpAddress = "169.254.169.254"
+var magicIpAddress = net.ParseIP("169.254.169.254")
+
+// maxCNAMEChain is the maximum number of CNAME records followed when resolving a hostname.
+const maxCNAMEChain = 8
 
-func isPrivateIP(ip string) bool {
-	ipAddress := net.ParseIP(ip)
-	return ipAddress.IsPrivate() || ipAddress.IsLoopback()
+// resolutionDelay is how long to wait for AAAA records after the A records are resolved when using HappyEyeballs (RFC 8305).
+const resolutionDelay = 50 * time.Millisecond
+
+// aaaaGracePeriod is how long to wait for AAAA records after the A records are resolved for the other family preferences.
+const aaaaGracePeriod = time.Second
+
+// isPrivate returns true if the ip is a private, loopback, link-local or unspecified IPv4 or IPv6 address.
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// parseIPLiteral returns the ip if the hostname is an IPv4 or IPv6 (optionally in brackets) address.
+func parseIPLiteral(hostname string) net.IP {
+	if strings.HasPrefix(hostname, "[") && strings.HasSuffix(hostname, "]") {
+		hostname = hostname[1 : len(hostname)-1]
+	}
+	return net.ParseIP(hostname)
 }
 
-// Lookup performs a DNS lookup for the given hostname and returns a valid IP address for the A record.
+// Lookup performs a DNS lookup for the given hostname and returns a valid IP address in the preferred address family.
+// The address is the first one returned by LookupAll so if the hostname has more than one address in the preferred
+// family a random one is returned, and with HappyEyeballs it is an IPv6 address when the hostname has one.
 func (d *Dns) Lookup(ctx context.Context, hostname string) (bool, *net.IP, error) {
+	ips, err := d.LookupAll(ctx, hostname)
+	if err != nil {
+		return false, nil, err
+	}
+	if d.observer != nil {
+		d.observer.OnSelect(hostname, ips[0], len(ips))
+	}
+	return true, &ips[0], nil
+}
+
+// LookupAll performs a DNS lookup for the A and AAAA records of the hostname and returns every valid address
+// ordered by the family preference. Addresses in the same family are shuffled. Once the A records are resolved
+// the lookup doesn't wait more than a second (50ms with HappyEyeballs) for the AAAA records.
+func (d *Dns) LookupAll(ctx context.Context, hostname string) ([]net.IP, error) {
+	trace := ContextClientTrace(ctx)
+	if trace != nil && trace.LookupStart != nil {
+		trace.LookupStart(LookupStartInfo{Host: hostname})
+	}
+	ips, cached, err := d.checkedLookupAll(ctx, hostname)
+	if trace != nil && trace.LookupDone != nil {
+		trace.LookupDone(LookupDoneInfo{Addrs: ips, Cached: cached, Err: err})
+	}
+	return ips, err
+}
+
+func (d *Dns) checkedLookupAll(ctx context.Context, hostname string) ([]net.IP, bool, error) {
+	if d.guard == nil {
+		return d.lookupAll(ctx, hostname)
+	}
+	if err := d.guard.CheckHost(hostname); err != nil {
+		return nil, false, err
+	}
+	ips, cached, err := d.lookupAll(ctx, hostname)
+	if err != nil {
+		return nil, cached, err
+	}
+	// every address is checked (not just the first) since the caller may try any of them
+	for _, ip := range ips {
+		if err := d.guard.CheckIP(ip); err != nil {
+			return nil, cached, err
+		}
+	}
+	return ips, cached, nil
+}
+
+// lookupAll returns the addresses for the hostname and whether they were returned from the cache.
+func (d *Dns) lookupAll(ctx context.Context, hostname string) ([]net.IP, bool, error) {
 	if (hostname == "localhost" || hostname == "127.0.0.1") && d.isLocal {
-		return true, &net.IP{127, 0, 0, 1}, nil
+		return []net.IP{{127, 0, 0, 1}}, false, nil
 	}
 	if hostname == "host.docker.internal" && d.isLocal {
 		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", hostname)
 		if err != nil {
-			return false, nil, fmt.Errorf("failed to resolve host.docker.internal: %w", err)
+			return nil, false, fmt.Errorf("failed to resolve host.docker.internal: %w", err)
 		}
 		if len(ips) == 0 {
-			return false, nil, fmt.Errorf("no IP addresses found for host.docker.internal")
+			return nil, false, fmt.Errorf("no IP addresses found for host.docker.internal")
 		}
-		return true, &ips[0], nil
+		return ips, false, nil
 	}
-	if isPrivateIP(hostname) && !d.isLocal {
-		return false, nil, ErrInvalidIP
+	if ip := parseIPLiteral(hostname); ip != nil {
+		if ip.Equal(magicIpAddress) || (isPrivate(ip) && !d.isLocal) {
+			return nil, false, ErrInvalidIP
+		}
+		return []net.IP{ip}, false, nil
 	}
-	if hostname == magicIpAddress {
-		return false, nil, ErrInvalidIP
+	var stale []net.IP
+	if ok, val, _ := d.cache.Get(fmt.Sprintf("dns:%s", hostname)); ok {
+		if entry, ok := toCachedAddresses(val); ok {
+			if entry.fresh(time.Now()) {
+				if d.observer != nil {
+					d.observer.OnCacheHit(hostname)
+				}
+				if d.prefetch > 0 {
+					d.maybePrefetch(ctx, hostname, entry)
+				}
+				return orderIPs(entry.IPs, d.family), true, nil
+			}
+			stale = entry.IPs
+		}
 	}
-	if ipv4.MatchString(hostname) {
-		ip := net.ParseIP(hostname)
-		if ip == nil {
-			return false, nil, fmt.Errorf("failed to parse ip address: %s", hostname)
+	if d.negativeTTL > 0 {
+		if ok, val, _ := d.cache.Get(fmt.Sprintf("dns-negative:%s", hostname)); ok {
+			if msg, ok := val.(string); ok {
+				if d.observer != nil {
+					d.observer.OnCacheHit(hostname)
+				}
+				return nil, true, errors.New(msg)
+			}
 		}
-		return true, &ip, nil
 	}
-	cacheKey := fmt.Sprintf("dns:%s", hostname)
-	ok, val, _ := d.cache.Get(cacheKey)
-	if ok {
-		ip, ok := val.([]net.IP)
-		if ok {
-			// only 1 ip, return it
-			if len(ip) == 1 {
-				return true, &ip[0], nil
+	if d.observer != nil {
+		d.observer.OnCacheMiss(hostname)
+	}
+	ips, err := d.fetch(ctx, hostname)
+	if err != nil {
+		var negative *negativeAnswer
+		if len(stale) > 0 && !errors.As(err, &negative) && !errors.Is(err, ErrInvalidIP) {
+			// the upstream failed so serve the expired addresses
+			if d.observer != nil {
+				d.observer.OnStale(hostname, err)
 			}
-			// more than 1 ip, return a random one
-			i := rand.Int31n(int32(len(ip)))
-			return true, &ip[i], nil
+			return orderIPs(stale, d.family), true, nil
 		}
+		return nil, false, err
 	}
+	return orderIPs(ips, d.family), false, nil
+}
+
+// fetch resolves the hostname from the upstream resolver and caches the result.
+func (d *Dns) fetch(ctx context.Context, hostname string) ([]net.IP, error) {
 	c, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
-	req, err := http.NewRequestWithContext(c, "GET", "https://cloudflare-dns.com/dns-query?name="+url.QueryEscape(hostname), nil)
+	ips, minTTL, err := d.resolveAll(c, hostname)
 	if err != nil {
-		return false, nil, err
+		var negative *negativeAnswer
+		if d.negativeTTL > 0 && errors.As(err, &negative) {
+			// use the SOA derived TTL (RFC 2308) unless it is longer than the configured TTL
+			expires := d.negativeTTL
+			if negative.ttl > 0 && time.Duration(negative.ttl)*time.Second < expires {
+				expires = time.Duration(negative.ttl) * time.Second
+			}
+			d.cache.Set(fmt.Sprintf("dns-negative:%s", hostname), err.Error(), expires)
+		}
+		return nil, err
 	}
-	req.Header.Set("accept", "application/dns-json")
-	req.Header.Set("user-agent", "Shopmonkey (+https://shopmonkey.io)")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return false, nil, err
+	for _, ip := range ips {
+		if ip.Equal(magicIpAddress) || (isPrivate(ip) && !d.isLocal) {
+			return nil, ErrInvalidIP
+		}
+	}
+	expires := max(time.Duration(minTTL)*time.Second, d.minTTL)
+	if expires > time.Hour*24 {
+		expires = time.Hour * 24
+	}
+	now := time.Now()
+	d.cache.Set(fmt.Sprintf("dns:%s", hostname), cachedAddresses{IPs: ips, Updated: now, Expires: now.Add(expires)}, expires+d.serveStale)
+	return ips, nil
+}
+
+// maybePrefetch refreshes a popular entry in the background when it is in the last 10% of its TTL.
+func (d *Dns) maybePrefetch(ctx context.Context, hostname string, entry cachedAddresses) {
+	if entry.Updated.IsZero() || time.Until(entry.Expires) > entry.Expires.Sub(entry.Updated)/10 {
+		return
+	}
+	d.mutex.Lock()
+	if d.prefetching[hostname] {
+		d.mutex.Unlock()
+		return
+	}
+	// only entries near expiry get this far so the hits are checked at most a few times per TTL
+	if found, hits := d.cache.Hits(fmt.Sprintf("dns:%s", hostname)); !found || hits < d.prefetch {
+		d.mutex.Unlock()
+		return
+	}
+	if d.prefetching == nil {
+		d.prefetching = make(map[string]bool)
+	}
+	d.prefetching[hostname] = true
+	d.mutex.Unlock()
+	go func() {
+		defer func() {
+			d.mutex.Lock()
+			delete(d.prefetching, hostname)
+			d.mutex.Unlock()
+		}()
+		// the lookup which triggered the prefetch has finished so don't report the refresh to its trace
+		d.fetch(WithClientTrace(context.WithoutCancel(ctx), nil), hostname)
+	}()
+}
+
+// negativeAnswer is an error for a name which doesn't exist or has no addresses which can be cached.
+type negativeAnswer struct {
+	err error
+	ttl uint // the negative TTL from the SOA record, 0 if there wasn't one
+}
+
+func (e *negativeAnswer) Error() string {
+	return e.err.Error()
+}
+
+func (e *negativeAnswer) Unwrap() error {
+	return e.err
+}
+
+// soaTTL returns the negative caching TTL from the SOA record in the authority section which is the
+// minimum of the record TTL and the SOA minimum field (RFC 2308).
+func soaTTL(authority []Answer) uint {
+	for _, a := range authority {
+		if a.Type != SOA {
+			continue
+		}
+		fields := strings.Fields(a.Data)
+		if len(fields) != 7 {
+			continue
+		}
+		minimum, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			continue
+		}
+		return min(a.TTL, uint(minimum))
+	}
+	return 0
+}
+
+type resolved struct {
+	ips []net.IP
+	ttl uint
+	err error
+}
+
+// resolveAll resolves the A and AAAA records concurrently and returns the addresses and the minimum TTL.
+func (d *Dns) resolveAll(ctx context.Context, hostname string) ([]net.IP, uint, error) {
+	v4 := make(chan resolved, 1)
+	v6 := make(chan resolved, 1)
+	for qtype, ch := range map[RecordType]chan resolved{A: v4, AAAA: v6} {
+		go func() {
+			ips, ttl, err := d.resolve(ctx, hostname, qtype)
+			ch <- resolved{ips, ttl, err}
+		}()
 	}
-	if resp.StatusCode != http.StatusOK {
-		return false, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	a := <-v4
+	var aaaa resolved
+	if a.err == nil && len(a.ips) > 0 {
+		// don't hold up the connection for slow AAAA queries
+		delay := aaaaGracePeriod
+		if d.family == HappyEyeballs {
+			delay = resolutionDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case aaaa = <-v6:
+		case <-timer.C:
+		}
+		timer.Stop()
+	} else {
+		aaaa = <-v6
 	}
-	var res Result
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return false, nil, fmt.Errorf("failed to decode dns json response: %w", err)
+	ips := append(a.ips, aaaa.ips...)
+	if len(ips) == 0 {
+		if a.err != nil {
+			return nil, 0, a.err
+		}
+		if aaaa.err != nil {
+			return nil, 0, aaaa.err
+		}
+		return nil, 0, &negativeAnswer{fmt.Errorf("no A or AAAA records found for %s", hostname), minNonZero(a.ttl, aaaa.ttl)}
 	}
-	if res.Status != NoError {
-		return false, nil, fmt.Errorf("dns lookup failed: %s", res.Status)
+	ttl := a.ttl
+	if ttl == 0 || (aaaa.ttl > 0 && aaaa.ttl < ttl) {
+		ttl = aaaa.ttl
 	}
-	var ips []net.IP
+	return ips, ttl, nil
+}
+
+// resolve queries the records of qtype for the hostname following any CNAME chain and returns the addresses
+// and the minimum TTL of the records in the chain.
+func (d *Dns) resolve(ctx context.Context, hostname string, qtype RecordType) ([]net.IP, uint, error) {
+	name := fqdn(strings.ToLower(hostname))
+	seen := map[string]bool{name: true}
 	var minTTL uint
-	for _, a := range res.Answer {
-		if a.Type == A {
-			if minTTL == 0 || a.TTL < minTTL {
-				minTTL = a.TTL
+	for i := 0; i < maxCNAMEChain; i++ {
+		res, err := d.resolveUpstream(ctx, name, qtype)
+		if err != nil {
+			return nil, 0, err
+		}
+		if res.Status == NXDomain {
+			return nil, 0, &negativeAnswer{fmt.Errorf("dns lookup failed: %s", res.Status), soaTTL(res.Authority)}
+		}
+		if res.Status != NoError {
+			return nil, 0, fmt.Errorf("dns lookup failed: %s", res.Status)
+		}
+		target, ttl, err := followChain(res.Answer, name, seen)
+		if err != nil {
+			return nil, 0, err
+		}
+		minTTL = minNonZero(minTTL, ttl)
+		var ips []net.IP
+		for _, a := range res.Answer {
+			if a.Type != qtype || fqdn(strings.ToLower(a.Name)) != target {
+				continue // skip records which aren't for the end of the chain
 			}
 			ip := net.ParseIP(a.Data)
 			if ip == nil {
-				return false, nil, fmt.Errorf("failed to parse ip address: %s", a.Data)
+				return nil, 0, fmt.Errorf("failed to parse ip address: %s", a.Data)
 			}
+			minTTL = minNonZero(minTTL, a.TTL)
 			ips = append(ips, ip)
 		}
+		if len(ips) > 0 {
+			return ips, minTTL, nil
+		}
+		if target == name {
+			// no records so return the negative TTL
+			return nil, soaTTL(res.Authority), nil
+		}
+		// the answer ended with a CNAME without its records so query the target
+		name = target
 	}
-	if len(ips) == 0 {
-		return false, nil, fmt.Errorf("no A records found for %s", hostname)
+	return nil, 0, fmt.Errorf("cname chain too long for %s", hostname)
+}
+
+// resolveUpstream queries the upstream resolver and reports the query to the observer and trace.
+func (d *Dns) resolveUpstream(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	started := time.Now()
+	res, err := d.resolver.Resolve(ctx, name, qtype)
+	latency := time.Since(started)
+	var status StatusType
+	if res != nil {
+		status = res.Status
 	}
-	if (ips[0].IsPrivate() || ips[0].IsLoopback()) && !d.isLocal {
-		return false, nil, ErrInvalidIP
+	if d.observer != nil {
+		d.observer.OnUpstream(name, qtype, status, latency, err)
 	}
-	expires := time.Duration(minTTL) * time.Second
-	if expires > time.Hour*24 {
-		expires = time.Hour * 24
+	if trace := ContextClientTrace(ctx); trace != nil && trace.UpstreamDone != nil {
+		trace.UpstreamDone(UpstreamDoneInfo{Host: name, Type: qtype, Status: status, Latency: latency, Err: err})
 	}
-	d.cache.Set(cacheKey, ips, expires)
-	return true, &ips[0], nil
+	return res, err
+}
+
+// followChain follows the CNAME records in the answers from name and returns the final name and the minimum TTL.
+func followChain(answers []Answer, name string, seen map[string]bool) (string, uint, error) {
+	cnames := make(map[string]Answer)
+	for _, a := range answers {
+		if a.Type == CNAME {
+			cnames[fqdn(strings.ToLower(a.Name))] = a
+		}
+	}
+	var minTTL uint
+	for {
+		cname, ok := cnames[name]
+		if !ok {
+			return name, minTTL, nil
+		}
+		name = fqdn(strings.ToLower(cname.Data))
+		if seen[name] {
+			return "", 0, fmt.Errorf("cname loop detected for %s", name)
+		}
+		if len(seen) > maxCNAMEChain {
+			return "", 0, fmt.Errorf("cname chain too long for %s", name)
+		}
+		seen[name] = true
+		minTTL = minNonZero(minTTL, cname.TTL)
+	}
+}
+
+func minNonZero(a, b uint) uint {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// orderIPs returns a copy of the ips ordered by the family preference with the addresses of each family shuffled.
+func orderIPs(ips []net.IP, family FamilyPreference) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	rand.Shuffle(len(v4), func(i, j int) { v4[i], v4[j] = v4[j], v4[i] })
+	rand.Shuffle(len(v6), func(i, j int) { v6[i], v6[j] = v6[j], v6[i] })
+	ordered := make([]net.IP, 0, len(ips))
+	switch family {
+	case PreferIPv6:
+		ordered = append(append(ordered, v6...), v4...)
+	case HappyEyeballs:
+		// interleave the families starting with IPv6 (RFC 8305)
+		for i := 0; i < len(v4) || i < len(v6); i++ {
+			if i < len(v6) {
+				ordered = append(ordered, v6[i])
+			}
+			if i < len(v4) {
+				ordered = append(ordered, v4[i])
+			}
+		}
+	default:
+		ordered = append(append(ordered, v4...), v6...)
+	}
+	return ordered
 }
 
 // New creates a new DNS caching resolver.
@@ -191,8 +574,23 @@ func New(cache cache.Cache, opts ...WithConfig) *Dns {
 		opt(&config)
 	}
 	val := &Dns{
-		cache:   cache,
-		isLocal: !config.FailIfLocal,
+		cache:       cache,
+		isLocal:     !config.FailIfLocal,
+		resolver:    CloudflareResolver(),
+		family:      config.Family,
+		guard:       config.Guard,
+		negativeTTL: config.NegativeTTL,
+		serveStale:  config.ServeStale,
+		minTTL:      config.MinTTL,
+		prefetch:    config.Prefetch,
+		observer:    config.Observer,
+	}
+	switch len(config.Resolvers) {
+	case 0:
+	case 1:
+		val.resolver = config.Resolvers[0]
+	default:
+		val.resolver = NewFailoverResolver(config.Resolvers...)
 	}
 	return val
 }
@@ -205,3 +603,62 @@ func WithFailIfLocal() WithConfig {
 		config.FailIfLocal = true
 	}
 }
+
+// WithResolvers sets the upstream resolvers which are tried in order until one answers, defaults to Cloudflare DNS over HTTPS.
+func WithResolvers(resolvers ...Resolver) WithConfig {
+	return func(config *dnsConfig) {
+		config.Resolvers = resolvers
+	}
+}
+
+// WithFamilyPreference sets the order of the addresses returned by LookupAll, defaults to PreferIPv4.
+func WithFamilyPreference(family FamilyPreference) WithConfig {
+	return func(config *dnsConfig) {
+		config.Family = family
+	}
+}
+
+// WithGuard checks the hostname and every resolved address with the guard. Addresses allowed by WithFailIfLocal
+// not being set (such as localhost) are still blocked by the guard.
+func WithGuard(guard *Guard) WithConfig {
+	return func(config *dnsConfig) {
+		config.Guard = guard
+	}
+}
+
+// WithNegativeTTL caches NXDomain and empty answers for the negative TTL from the SOA record (RFC 2308)
+// or ttl if there is no SOA record or the SOA TTL is longer than ttl.
+func WithNegativeTTL(ttl time.Duration) WithConfig {
+	return func(config *dnsConfig) {
+		config.NegativeTTL = ttl
+	}
+}
+
+// WithServeStale returns addresses for up to window after they expire if the upstream resolvers fail.
+func WithServeStale(window time.Duration) WithConfig {
+	return func(config *dnsConfig) {
+		config.ServeStale = window
+	}
+}
+
+// WithMinTTL sets the minimum time addresses are cached regardless of the record TTL.
+func WithMinTTL(ttl time.Duration) WithConfig {
+	return func(config *dnsConfig) {
+		config.MinTTL = ttl
+	}
+}
+
+// WithPrefetch refreshes entries which have been used at least hits times in the background when they
+// are looked up in the last 10% of their TTL so popular entries don't expire.
+func WithPrefetch(hits int) WithConfig {
+	return func(config *dnsConfig) {
+		config.Prefetch = hits
+	}
+}
+
+// WithObserver sets the observer which receives the cache, upstream and address selection events for metrics.
+func WithObserver(observer Observer) WithConfig {
+	return func(config *dnsConfig) {
+		config.Observer = observer
+	}
+}
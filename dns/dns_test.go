@@ -2,11 +2,14 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/shopmonkeyus/go-common/cache"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestDNSIsValidAndCached(t *testing.T) {
@@ -172,3 +175,236 @@ func TestInvalidDNSEntries(t *testing.T) {
 		})
 	}
 }
+
+func newStubDNS(t *testing.T, family FamilyPreference, records ...dnsmessage.Resource) (*Dns, cache.Cache) {
+	s := runStubServer(t, records...)
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	t.Cleanup(func() { c.Close() })
+	return New(c, WithFailIfLocal(), WithFamilyPreference(family), WithResolvers(NewUDPResolver(s.Addr()))), c
+}
+
+func TestLookupAllFamilyPreference(t *testing.T) {
+	records := []dnsmessage.Resource{
+		aRecord("example.test.", 300, "93.184.216.34"),
+		aRecord("example.test.", 300, "93.184.216.35"),
+		aaaaRecord("example.test.", 120, "2606:2800:220:1::248"),
+	}
+	d, c := newStubDNS(t, PreferIPv4, records...)
+	ips, err := d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Len(t, ips, 3)
+	assert.NotNil(t, ips[0].To4())
+	assert.NotNil(t, ips[1].To4())
+	assert.Equal(t, "2606:2800:220:1::248", ips[2].String())
+	found, ttl, _ := c.TTL("dns:example.test")
+	assert.True(t, found)
+	assert.Equal(t, 2*time.Minute, ttl.Round(time.Second), "should use the minimum ttl of both families")
+
+	d, _ = newStubDNS(t, PreferIPv6, records...)
+	ips, err = d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "2606:2800:220:1::248", ips[0].String())
+	ok, ip, err := d.Lookup(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "2606:2800:220:1::248", ip.String())
+
+	d, _ = newStubDNS(t, HappyEyeballs, records...)
+	ips, err = d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Len(t, ips, 3)
+	assert.Nil(t, ips[0].To4())
+	assert.NotNil(t, ips[1].To4())
+	assert.NotNil(t, ips[2].To4())
+}
+
+// slowAAAAResolver answers A queries immediately and AAAA queries when the context is done.
+type slowAAAAResolver struct {
+	staticResolver
+}
+
+func (r *slowAAAAResolver) Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	if qtype == AAAA {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return r.staticResolver.Resolve(ctx, name, qtype)
+}
+
+func TestLookupAllDoesntWaitForSlowAAAA(t *testing.T) {
+	r := &slowAAAAResolver{staticResolver{res: &Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}}}}
+	d := New(cache.NewInMemory(context.Background(), time.Minute), WithResolvers(r))
+	started := time.Now()
+	ips, err := d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34")}, ips)
+	assert.Less(t, time.Since(started), 5*time.Second, "should stop waiting for the AAAA records after the grace period")
+}
+
+func TestLookupIPv6Only(t *testing.T) {
+	d, _ := newStubDNS(t, PreferIPv4, aaaaRecord("v6.test.", 300, "2606:2800:220:1::248"))
+	ok, ip, err := d.Lookup(context.Background(), "v6.test")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "2606:2800:220:1::248", ip.String())
+}
+
+func TestLookupCNAMEChain(t *testing.T) {
+	d, _ := newStubDNS(t, PreferIPv4,
+		cnameRecord("www.example.test.", 300, "cdn.example.test."),
+		cnameRecord("cdn.example.test.", 60, "edge.example.test."),
+		aRecord("edge.example.test.", 300, "93.184.216.34"),
+		cnameRecord("loop1.test.", 300, "loop2.test."),
+		cnameRecord("loop2.test.", 300, "loop1.test."),
+	)
+	ips, err := d.LookupAll(context.Background(), "www.example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "93.184.216.34", ips[0].String())
+
+	_, err = d.LookupAll(context.Background(), "loop1.test")
+	assert.ErrorContains(t, err, "cname loop detected")
+}
+
+func TestFollowChainIgnoresUnrelatedRecords(t *testing.T) {
+	answers := []Answer{
+		{Name: "www.example.test.", Type: CNAME, TTL: 300, Data: "edge.example.test."},
+		{Name: "other.test.", Type: A, TTL: 300, Data: "10.0.0.1"},
+		{Name: "edge.example.test.", Type: A, TTL: 30, Data: "93.184.216.34"},
+	}
+	d := New(cache.NewInMemory(context.Background(), time.Minute), WithResolvers(&staticResolver{res: &Result{Status: NoError, Answer: answers}}))
+	ips, ttl, err := d.resolve(context.Background(), "www.example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34")}, ips)
+	assert.Equal(t, uint(30), ttl)
+}
+
+func TestLookupPrivateIPv6(t *testing.T) {
+	d, _ := newStubDNS(t, PreferIPv4,
+		aRecord("mixed.test.", 300, "93.184.216.34"),
+		aaaaRecord("mixed.test.", 300, "fd00::1"),
+		aaaaRecord("linklocal.test.", 300, "fe80::1"),
+	)
+	_, err := d.LookupAll(context.Background(), "mixed.test")
+	assert.ErrorIs(t, err, ErrInvalidIP, "every resolved address should be checked")
+	_, err = d.LookupAll(context.Background(), "linklocal.test")
+	assert.ErrorIs(t, err, ErrInvalidIP)
+}
+
+func TestLookupIPv6Literal(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	d := New(c)
+	ok, ip, err := d.Lookup(context.Background(), "[2606:2800:220:1::248]")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "2606:2800:220:1::248", ip.String())
+	ok, ip, err = d.Lookup(context.Background(), "::1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, ip.IsLoopback())
+
+	d = New(c, WithFailIfLocal())
+	for _, hostname := range []string{"[::1]", "fe80::1", "fd12:3456::1", "[::ffff:10.0.0.1]", "::", "169.254.10.1"} {
+		_, _, err := d.Lookup(context.Background(), hostname)
+		assert.ErrorIs(t, err, ErrInvalidIP, hostname)
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	r := &staticResolver{res: &Result{Status: NXDomain, Authority: []Answer{
+		{Name: "test.", Type: SOA, TTL: 3600, Data: "ns.test. hostmaster.test. 1 7200 900 1209600 30"},
+	}}}
+	d := New(c, WithResolvers(r), WithNegativeTTL(time.Minute))
+	_, err := d.LookupAll(context.Background(), "missing.test")
+	assert.EqualError(t, err, "dns lookup failed: Non-Existent Domain")
+	calls := r.callCount()
+	_, err = d.LookupAll(context.Background(), "missing.test")
+	assert.EqualError(t, err, "dns lookup failed: Non-Existent Domain")
+	assert.Equal(t, calls, r.callCount(), "should be served from the negative cache")
+	found, ttl, _ := c.TTL("dns-negative:missing.test")
+	assert.True(t, found)
+	assert.Equal(t, 30*time.Second, ttl.Round(time.Second), "should use the SOA minimum")
+
+	// no SOA record so the configured ttl is used
+	r.set(&Result{Status: NoError}, nil)
+	_, err = d.LookupAll(context.Background(), "empty.test")
+	assert.EqualError(t, err, "no A or AAAA records found for empty.test")
+	found, ttl, _ = c.TTL("dns-negative:empty.test")
+	assert.True(t, found)
+	assert.Equal(t, time.Minute, ttl.Round(time.Second))
+
+	// server failures aren't cached
+	r.set(&Result{Status: ServFail}, nil)
+	_, err = d.LookupAll(context.Background(), "fail.test")
+	assert.Error(t, err)
+	found, _, _ = c.TTL("dns-negative:fail.test")
+	assert.False(t, found)
+}
+
+func TestServeStale(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	r := &staticResolver{res: &Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}}}
+	d := New(c, WithResolvers(r), WithServeStale(time.Hour))
+	_, err := d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	found, ttl, _ := c.TTL("dns:example.test")
+	assert.True(t, found)
+	assert.Equal(t, time.Hour+5*time.Minute, ttl.Round(time.Second), "should keep the entry for the stale window")
+
+	// the entry has expired and the upstream is down
+	expireAddresses(c, "example.test")
+	r.set(nil, errors.New("connection refused"))
+	ips, err := d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "93.184.216.34", ips[0].String())
+
+	// the name no longer exists so the stale addresses shouldn't be used
+	r.set(&Result{Status: NXDomain}, nil)
+	_, err = d.LookupAll(context.Background(), "example.test")
+	assert.EqualError(t, err, "dns lookup failed: Non-Existent Domain")
+}
+
+// expireAddresses marks the cached addresses for the hostname as expired while keeping them for serve stale.
+func expireAddresses(c cache.Cache, hostname string) {
+	key := "dns:" + hostname
+	if ok, val, _ := c.Get(key); ok {
+		entry := val.(cachedAddresses)
+		entry.Expires = time.Now().Add(-time.Second)
+		c.Set(key, entry, time.Minute)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	r := &staticResolver{res: &Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 5, Data: "93.184.216.34"}}}}
+	d := New(c, WithResolvers(r), WithMinTTL(time.Minute))
+	_, err := d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	found, ttl, _ := c.TTL("dns:example.test")
+	assert.True(t, found)
+	assert.Equal(t, time.Minute, ttl.Round(time.Second))
+}
+
+func TestPrefetch(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	r := &staticResolver{res: &Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.35"}}}}
+	d := New(c, WithResolvers(r), WithPrefetch(1))
+	now := time.Now()
+	c.Set("dns:example.test", cachedAddresses{IPs: []net.IP{net.ParseIP("93.184.216.34")}, Updated: now, Expires: now.Add(time.Second)}, time.Second)
+	time.Sleep(950 * time.Millisecond)
+	ips, err := d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "93.184.216.34", ips[0].String(), "should return the cached entry while refreshing")
+	assert.Eventually(t, func() bool {
+		found, ttl, _ := c.TTL("dns:example.test")
+		return found && ttl > time.Minute
+	}, time.Second, 10*time.Millisecond)
+	ips, err = d.LookupAll(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, "93.184.216.35", ips[0].String())
+}
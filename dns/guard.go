@@ -0,0 +1,203 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// defaultDeniedCIDRs are the ranges blocked by a Guard which aren't publicly routable or which embed
+// another address (which could be used to reach a blocked address).
+var defaultDeniedCIDRs = []string{
+	"0.0.0.0/8",       // this network
+	"10.0.0.0/8",      // RFC1918
+	"100.64.0.0/10",   // carrier grade NAT (includes the alibaba cloud metadata endpoint)
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local (includes the cloud metadata endpoint)
+	"172.16.0.0/12",   // RFC1918
+	"192.0.0.0/24",    // IETF protocol assignments (includes the oracle cloud metadata endpoint)
+	"192.0.2.0/24",    // TEST-NET-1
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // RFC1918
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // TEST-NET-2
+	"203.0.113.0/24",  // TEST-NET-3
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"::/96",           // IPv4-compatible (deprecated)
+	"::ffff:0:0/96",   // IPv4-mapped
+	"64:ff9b::/96",    // NAT64
+	"64:ff9b:1::/48",  // local-use NAT64
+	"100::/64",        // discard-only
+	"2001::/32",       // teredo
+	"2001:db8::/32",   // documentation
+	"2002::/16",       // 6to4
+	"fc00::/7",        // unique local (includes the aws IPv6 metadata endpoint)
+	"fe80::/10",       // link-local
+	"fec0::/10",       // site-local (deprecated)
+	"ff00::/8",        // multicast
+}
+
+// defaultDeniedHosts are the cloud metadata hostnames blocked by a Guard.
+var defaultDeniedHosts = []string{
+	"metadata",
+	"metadata.google.internal",
+	"metadata.goog",
+	"instance-data",
+	"instance-data.ec2.internal",
+}
+
+// Guard protects against server side request forgery by blocking addresses which aren't publicly routable
+// and cloud metadata endpoints.
+type Guard struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+	hosts map[string]bool
+}
+
+type guardOpts struct {
+	allow []string
+	deny  []string
+	hosts []string
+}
+
+type GuardOpt func(opts *guardOpts)
+
+// WithAllowCIDRs allows addresses in the CIDRs even if they are in a denied range.
+func WithAllowCIDRs(cidrs ...string) GuardOpt {
+	return func(opts *guardOpts) {
+		opts.allow = append(opts.allow, cidrs...)
+	}
+}
+
+// WithDenyCIDRs blocks addresses in the CIDRs in addition to the default ranges.
+func WithDenyCIDRs(cidrs ...string) GuardOpt {
+	return func(opts *guardOpts) {
+		opts.deny = append(opts.deny, cidrs...)
+	}
+}
+
+// WithDenyHosts blocks the hostnames in addition to the default cloud metadata hostnames.
+func WithDenyHosts(hosts ...string) GuardOpt {
+	return func(opts *guardOpts) {
+		opts.hosts = append(opts.hosts, hosts...)
+	}
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %s: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// NewGuard returns a new Guard which blocks the private, shared, link-local, multicast, reserved and
+// translated IPv4 and IPv6 ranges and the cloud metadata endpoints.
+func NewGuard(opts ...GuardOpt) (*Guard, error) {
+	var config guardOpts
+	for _, opt := range opts {
+		opt(&config)
+	}
+	allow, err := parsePrefixes(config.allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parsePrefixes(slices.Concat(defaultDeniedCIDRs, config.deny))
+	if err != nil {
+		return nil, err
+	}
+	g := &Guard{allow: allow, deny: deny, hosts: make(map[string]bool)}
+	for _, host := range slices.Concat(defaultDeniedHosts, config.hosts) {
+		g.hosts[normalizeHost(host)] = true
+	}
+	return g, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// CheckAddr returns an error wrapping ErrInvalidIP if the address is blocked.
+func (g *Guard) CheckAddr(addr netip.Addr) error {
+	addr = addr.WithZone("")
+	for _, prefix := range g.allow {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	if addr.Is4In6() {
+		// check the embedded address against any IPv4 allow ranges before blocking the mapped range
+		for _, prefix := range g.allow {
+			if prefix.Contains(addr.Unmap()) {
+				return nil
+			}
+		}
+	}
+	for _, prefix := range g.deny {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s is in blocked range %s", ErrInvalidIP, addr, prefix)
+		}
+	}
+	return nil
+}
+
+// CheckIP returns an error wrapping ErrInvalidIP if the ip is blocked. IPv4 addresses stored in
+// the 16 byte form used by the net package are checked as IPv4 addresses.
+func (g *Guard) CheckIP(ip net.IP) error {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidIP, ip)
+	}
+	return g.CheckAddr(addr)
+}
+
+// CheckHost returns an error wrapping ErrInvalidIP if the host is a blocked hostname or blocked ip address.
+func (g *Guard) CheckHost(host string) error {
+	host = normalizeHost(host)
+	if g.hosts[host] {
+		return fmt.Errorf("%w: %s is a blocked hostname", ErrInvalidIP, host)
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return g.CheckAddr(addr)
+	}
+	return nil
+}
+
+// Control can be used as the net.Dialer Control function to check the address being connected to. Checking the
+// address at dial time (instead of when the hostname is resolved) prevents DNS rebinding attacks.
+func (g *Guard) Control(network string, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidIP, address)
+	}
+	return g.CheckAddr(addrPort.Addr())
+}
+
+// CheckRedirect can be used as the http.Client CheckRedirect function to check the host of each redirect.
+// The addresses the redirect resolves to must also be checked when dialing (for example with Control).
+func (g *Guard) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	return g.CheckURL(req.URL)
+}
+
+// CheckURL returns an error wrapping ErrInvalidIP if the url host is a blocked hostname or blocked ip address.
+func (g *Guard) CheckURL(u *url.URL) error {
+	return g.CheckHost(u.Hostname())
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardBlocksDefaultRanges(t *testing.T) {
+	g, err := NewGuard()
+	assert.NoError(t, err)
+	for _, ip := range []string{
+		"10.1.2.3", "172.16.0.1", "192.168.1.1", "100.64.0.1", "127.0.0.1", "169.254.169.254", "0.0.0.0",
+		"224.0.0.1", "255.255.255.255", "100.100.100.200", "192.0.0.192",
+		"::1", "::", "fe80::1", "fd00:ec2::254", "fc00::1", "ff02::1", "64:ff9b::a9fe:a9fe", "2002:a9fe:a9fe::1", "2001::1",
+	} {
+		assert.ErrorIs(t, g.CheckIP(net.ParseIP(ip)), ErrInvalidIP, ip)
+	}
+	for _, ip := range []string{"93.184.216.34", "8.8.8.8", "2606:2800:220:1::248", "2001:4860:4860::8888"} {
+		assert.NoError(t, g.CheckIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestGuardIPv4Mapped(t *testing.T) {
+	g, err := NewGuard()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, g.CheckAddr(netip.MustParseAddr("::ffff:93.184.216.34")), ErrInvalidIP)
+	assert.ErrorIs(t, g.CheckHost("[::ffff:7f00:1]"), ErrInvalidIP)
+	assert.ErrorIs(t, g.CheckIP(net.ParseIP("::ffff:10.0.0.1")), ErrInvalidIP)
+	assert.ErrorIs(t, g.CheckAddr(netip.MustParseAddr("::7f00:1")), ErrInvalidIP, "IPv4-compatible addresses should be blocked")
+	assert.ErrorIs(t, g.CheckHost("[::a9fe:a9fe]"), ErrInvalidIP)
+	assert.NoError(t, g.CheckIP(net.ParseIP("93.184.216.34")), "16 byte IPv4 addresses should be checked as IPv4")
+}
+
+func TestGuardAllowAndDeny(t *testing.T) {
+	g, err := NewGuard(WithAllowCIDRs("10.1.0.0/16"), WithDenyCIDRs("93.184.216.0/24"), WithDenyHosts("internal.example.com"))
+	assert.NoError(t, err)
+	assert.NoError(t, g.CheckIP(net.ParseIP("10.1.2.3")))
+	assert.ErrorIs(t, g.CheckIP(net.ParseIP("10.2.0.1")), ErrInvalidIP)
+	assert.ErrorIs(t, g.CheckIP(net.ParseIP("93.184.216.34")), ErrInvalidIP)
+	assert.ErrorIs(t, g.CheckHost("Internal.Example.com."), ErrInvalidIP)
+	assert.ErrorIs(t, g.CheckHost("metadata.google.internal"), ErrInvalidIP)
+	assert.NoError(t, g.CheckHost("example.com"))
+
+	_, err = NewGuard(WithAllowCIDRs("not a cidr"))
+	assert.Error(t, err)
+}
+
+func TestGuardControl(t *testing.T) {
+	g, err := NewGuard()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, g.Control("tcp4", "127.0.0.1:80", nil), ErrInvalidIP)
+	assert.ErrorIs(t, g.Control("tcp6", "[fe80::1%eth0]:80", nil), ErrInvalidIP)
+	assert.NoError(t, g.Control("tcp4", "93.184.216.34:443", nil))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	dialer := net.Dialer{Control: g.Control}
+	_, err = dialer.Dial("tcp", ln.Addr().String())
+	assert.ErrorIs(t, err, ErrInvalidIP)
+}
+
+func TestGuardCheckRedirect(t *testing.T) {
+	g, err := NewGuard()
+	assert.NoError(t, err)
+	redirect := &http.Request{URL: &url.URL{Scheme: "http", Host: "169.254.169.254"}}
+	assert.ErrorIs(t, g.CheckRedirect(redirect, []*http.Request{{}}), ErrInvalidIP)
+	redirect = &http.Request{URL: &url.URL{Scheme: "https", Host: "example.com"}}
+	assert.NoError(t, g.CheckRedirect(redirect, []*http.Request{{}}))
+	assert.Error(t, g.CheckRedirect(redirect, make([]*http.Request, 10)))
+}
+
+func TestLookupWithGuard(t *testing.T) {
+	s := runStubServer(t, aRecord("public.test.", 300, "93.184.216.34"), aRecord("mixed.test.", 300, "93.184.216.35"), aRecord("mixed.test.", 300, "100.64.1.1"))
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	g, err := NewGuard()
+	assert.NoError(t, err)
+	d := New(c, WithGuard(g), WithResolvers(NewUDPResolver(s.Addr())))
+	ips, err := d.LookupAll(context.Background(), "public.test")
+	assert.NoError(t, err)
+	assert.Len(t, ips, 1)
+	_, err = d.LookupAll(context.Background(), "mixed.test")
+	assert.ErrorIs(t, err, ErrInvalidIP, "a blocked address anywhere in the answer should be blocked")
+	_, _, err = d.Lookup(context.Background(), "localhost")
+	assert.ErrorIs(t, err, ErrInvalidIP, "the guard should apply even when local addresses are allowed")
+	_, _, err = d.Lookup(context.Background(), "metadata.google.internal")
+	assert.ErrorIs(t, err, ErrInvalidIP)
+}
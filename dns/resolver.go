@@ -0,0 +1,416 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// CloudflareURL is the Cloudflare DNS over HTTPS endpoint.
+	CloudflareURL = "https://cloudflare-dns.com/dns-query"
+	// GoogleURL is the Google DNS over HTTPS JSON API endpoint.
+	GoogleURL = "https://dns.google/resolve"
+	// GoogleWireURL is the Google DNS over HTTPS RFC 8484 wire format endpoint.
+	GoogleWireURL = "https://dns.google/dns-query"
+
+	defaultResolverTimeout = 5 * time.Second
+	// systemTTL is the TTL used for answers from the system resolver which doesn't return TTLs.
+	systemTTL  = 60
+	maxUDPSize = 1232
+)
+
+// Resolver queries an upstream DNS server.
+type Resolver interface {
+	// Resolve queries the records of the record type for name. A DNS error (such as NXDomain) is returned as the
+	// Result status, an error is only returned if the upstream couldn't be queried.
+	Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error)
+}
+
+type resolverOpts struct {
+	client  *http.Client
+	timeout time.Duration
+	wire    bool
+}
+
+type ResolverOpt func(opts *resolverOpts)
+
+// WithHTTPClient sets the http client used by a DNS over HTTPS resolver, defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) ResolverOpt {
+	return func(opts *resolverOpts) {
+		opts.client = client
+	}
+}
+
+// WithResolverTimeout sets the timeout for each query, defaults to 5 seconds.
+func WithResolverTimeout(timeout time.Duration) ResolverOpt {
+	return func(opts *resolverOpts) {
+		opts.timeout = timeout
+	}
+}
+
+// WithWireFormat makes a DNS over HTTPS resolver use the RFC 8484 wire format instead of the JSON API.
+func WithWireFormat() ResolverOpt {
+	return func(opts *resolverOpts) {
+		opts.wire = true
+	}
+}
+
+func newResolverOpts(opts []ResolverOpt) resolverOpts {
+	config := resolverOpts{client: http.DefaultClient, timeout: defaultResolverTimeout}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+type dohResolver struct {
+	url    string
+	config resolverOpts
+}
+
+var _ Resolver = (*dohResolver)(nil)
+
+func (r *dohResolver) Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.timeout)
+	defer cancel()
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns url: %w", err)
+	}
+	q := u.Query()
+	accept := "application/dns-json"
+	var query dnsQuery
+	if r.config.wire {
+		var msg []byte
+		msg, query, err = newQuery(name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("dns", base64.RawURLEncoding.EncodeToString(msg))
+		accept = "application/dns-message"
+	} else {
+		q.Set("name", name)
+		q.Set("type", fmt.Sprint(uint16(qtype)))
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", accept)
+	req.Header.Set("user-agent", "Shopmonkey (+https://shopmonkey.io)")
+	resp, err := r.config.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if r.config.wire {
+		buf, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dns response: %w", err)
+		}
+		res, _, err := parseResponse(buf, query)
+		return res, err
+	}
+	var res Result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode dns json response: %w", err)
+	}
+	return &res, nil
+}
+
+// NewDoHResolver returns a DNS over HTTPS resolver for url which uses the JSON API unless WithWireFormat is used.
+func NewDoHResolver(url string, opts ...ResolverOpt) Resolver {
+	return &dohResolver{url: url, config: newResolverOpts(opts)}
+}
+
+// CloudflareResolver returns a resolver for the Cloudflare DNS over HTTPS JSON API.
+func CloudflareResolver(opts ...ResolverOpt) Resolver {
+	return NewDoHResolver(CloudflareURL, opts...)
+}
+
+// GoogleResolver returns a resolver for the Google DNS over HTTPS JSON API or the wire format endpoint if
+// WithWireFormat is used.
+func GoogleResolver(opts ...ResolverOpt) Resolver {
+	if newResolverOpts(opts).wire {
+		return NewDoHResolver(GoogleWireURL, opts...)
+	}
+	return NewDoHResolver(GoogleURL, opts...)
+}
+
+type wireResolver struct {
+	network string
+	addr    string
+	config  resolverOpts
+}
+
+var _ Resolver = (*wireResolver)(nil)
+
+func (r *wireResolver) Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	res, truncated, err := r.exchange(ctx, r.network, name, qtype)
+	if err == nil && truncated && r.network == "udp" {
+		// the answer didn't fit in a udp packet, retry over tcp
+		res, _, err = r.exchange(ctx, "tcp", name, qtype)
+	}
+	return res, err
+}
+
+func (r *wireResolver) exchange(ctx context.Context, network string, name string, qtype RecordType) (*Result, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.timeout)
+	defer cancel()
+	msg, query, err := newQuery(name, qtype)
+	if err != nil {
+		return nil, false, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, r.addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to connect to %s: %w", r.addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	var buf []byte
+	if network == "tcp" {
+		// tcp messages are prefixed with a 2 byte length
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(msg)))); err != nil {
+			return nil, false, fmt.Errorf("failed to write dns query: %w", err)
+		}
+		if _, err := conn.Write(msg); err != nil {
+			return nil, false, fmt.Errorf("failed to write dns query: %w", err)
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, false, fmt.Errorf("failed to read dns response: %w", err)
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, false, fmt.Errorf("failed to read dns response: %w", err)
+		}
+	} else {
+		if _, err := conn.Write(msg); err != nil {
+			return nil, false, fmt.Errorf("failed to write dns query: %w", err)
+		}
+		buf = make([]byte, maxUDPSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to read dns response: %w", err)
+			}
+			res, truncated, err := parseResponse(buf[:n], query)
+			if err != nil {
+				// a stray or spoofed packet, keep waiting for the response until the deadline
+				continue
+			}
+			return res, truncated, nil
+		}
+	}
+	return parseResponse(buf, query)
+}
+
+// NewUDPResolver returns a resolver which queries the DNS server at addr (host:port) over UDP,
+// retrying over TCP if the response is truncated.
+func NewUDPResolver(addr string, opts ...ResolverOpt) Resolver {
+	return &wireResolver{network: "udp", addr: addr, config: newResolverOpts(opts)}
+}
+
+// NewTCPResolver returns a resolver which queries the DNS server at addr (host:port) over TCP.
+func NewTCPResolver(addr string, opts ...ResolverOpt) Resolver {
+	return &wireResolver{network: "tcp", addr: addr, config: newResolverOpts(opts)}
+}
+
+// dnsQuery is the id and question of a wire format query used to match the response.
+type dnsQuery struct {
+	id       uint16
+	question dnsmessage.Question
+}
+
+// matches returns true if the response header and question are for the query.
+func (q dnsQuery) matches(msg *dnsmessage.Message) bool {
+	if msg.Header.ID != q.id || !msg.Header.Response || len(msg.Questions) != 1 {
+		return false
+	}
+	question := msg.Questions[0]
+	return question.Type == q.question.Type && question.Class == q.question.Class &&
+		strings.EqualFold(question.Name.String(), q.question.Name.String())
+}
+
+func newQuery(name string, qtype RecordType) ([]byte, dnsQuery, error) {
+	qname, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, dnsQuery{}, fmt.Errorf("invalid dns name %s: %w", name, err)
+	}
+	query := dnsQuery{
+		id: uint16(rand.Intn(1 << 16)),
+		question: dnsmessage.Question{
+			Name:  qname,
+			Type:  dnsmessage.Type(qtype),
+			Class: dnsmessage.ClassINET,
+		},
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{query.question},
+	}
+	buf, err := msg.Pack()
+	if err != nil {
+		return nil, dnsQuery{}, fmt.Errorf("failed to encode dns query: %w", err)
+	}
+	return buf, query, nil
+}
+
+// parseResponse decodes a wire format response to the query into a Result and returns true if the response was truncated.
+func parseResponse(buf []byte, query dnsQuery) (*Result, bool, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return nil, false, fmt.Errorf("failed to decode dns response: %w", err)
+	}
+	if !query.matches(&msg) {
+		return nil, false, errors.New("unexpected dns response")
+	}
+	res := &Result{Status: StatusType(msg.Header.RCode)}
+	for _, rr := range msg.Answers {
+		answer := Answer{
+			Name: rr.Header.Name.String(),
+			Type: RecordType(rr.Header.Type),
+			TTL:  uint(rr.Header.TTL),
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			answer.Data = net.IP(body.A[:]).String()
+		case *dnsmessage.AAAAResource:
+			answer.Data = net.IP(body.AAAA[:]).String()
+		case *dnsmessage.CNAMEResource:
+			answer.Data = body.CNAME.String()
+		default:
+			continue
+		}
+		res.Answer = append(res.Answer, answer)
+	}
+	for _, rr := range msg.Authorities {
+		if soa, ok := rr.Body.(*dnsmessage.SOAResource); ok {
+			res.Authority = append(res.Authority, Answer{
+				Name: rr.Header.Name.String(),
+				Type: SOA,
+				TTL:  uint(rr.Header.TTL),
+				Data: fmt.Sprintf("%s %s %d %d %d %d %d", soa.NS, soa.MBox, soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.MinTTL),
+			})
+		}
+	}
+	return res, msg.Header.Truncated, nil
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+type systemResolver struct {
+	resolver *net.Resolver
+}
+
+var _ Resolver = (*systemResolver)(nil)
+
+func (r *systemResolver) Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	var res Result
+	switch qtype {
+	case A, AAAA:
+		network := "ip4"
+		if qtype == AAAA {
+			network = "ip6"
+		}
+		ips, err := r.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return systemError(err)
+		}
+		// the system resolver follows cname chains itself so the addresses are answered for name
+		for _, ip := range ips {
+			res.Answer = append(res.Answer, Answer{Name: fqdn(name), Type: qtype, TTL: systemTTL, Data: ip.String()})
+		}
+	case CNAME:
+		cname, err := r.resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return systemError(err)
+		}
+		if cname != fqdn(name) {
+			res.Answer = append(res.Answer, Answer{Name: fqdn(name), Type: CNAME, TTL: systemTTL, Data: cname})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type: %d", qtype)
+	}
+	return &res, nil
+}
+
+func systemError(err error) (*Result, error) {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return &Result{Status: NXDomain}, nil
+	}
+	return nil, err
+}
+
+// NewSystemResolver returns a resolver which uses a net.Resolver (net.DefaultResolver if nil). The system resolver
+// doesn't return TTLs so answers are cached for 60 seconds.
+func NewSystemResolver(resolver *net.Resolver) Resolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &systemResolver{resolver: resolver}
+}
+
+var errNoResolvers = errors.New("no dns resolvers")
+
+type failoverResolver struct {
+	resolvers []Resolver
+}
+
+var _ Resolver = (*failoverResolver)(nil)
+
+func (r *failoverResolver) Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	var errs []error
+	for _, resolver := range r.resolvers {
+		res, err := resolver.Resolve(ctx, name, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if res.Status == ServFail || res.Status == Refused {
+			errs = append(errs, fmt.Errorf("dns lookup failed: %s", res.Status))
+			continue
+		}
+		return res, nil
+	}
+	if len(errs) == 0 {
+		return nil, errNoResolvers
+	}
+	return nil, errors.Join(errs...)
+}
+
+// NewFailoverResolver returns a resolver which tries each resolver in order until one answers. A resolver which
+// returns an error, ServFail or Refused is skipped while any other answer (including NXDomain) is returned. A failover
+// resolver without any resolvers fails every lookup.
+func NewFailoverResolver(resolvers ...Resolver) Resolver {
+	return &failoverResolver{resolvers: resolvers}
+}
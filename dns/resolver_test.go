@@ -0,0 +1,373 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/cache"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stubServer is a local DNS server which answers from a fixed set of records.
+type stubServer struct {
+	records  map[string][]dnsmessage.Resource
+	rcode    dnsmessage.RCode
+	truncate atomic.Bool // set the truncated bit on udp responses
+	stray    atomic.Bool // send mismatched udp responses before the answer
+	udp      net.PacketConn
+	tcp      net.Listener
+}
+
+func (s *stubServer) answer(buf []byte, udp bool) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	q := msg.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.Header.ID, Response: true, RCode: s.rcode},
+		Questions: msg.Questions,
+	}
+	if udp && s.truncate.Load() {
+		resp.Header.Truncated = true
+	} else {
+		name := strings.ToLower(q.Name.String())
+		for _, rr := range s.records[name] {
+			if rr.Header.Type == q.Type || rr.Header.Type == dnsmessage.TypeCNAME {
+				resp.Answers = append(resp.Answers, rr)
+			}
+		}
+		if len(resp.Answers) == 0 && len(s.records[name]) == 0 && s.rcode == dnsmessage.RCodeSuccess {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+	}
+	out, _ := resp.Pack()
+	return out
+}
+
+func (s *stubServer) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if out := s.answer(buf[:n], true); out != nil {
+			if s.stray.Load() {
+				s.writeStray(out, addr)
+			}
+			s.udp.WriteTo(out, addr)
+		}
+	}
+}
+
+// writeStray sends copies of the response with the wrong id and the wrong question.
+func (s *stubServer) writeStray(out []byte, addr net.Addr) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(out); err != nil {
+		return
+	}
+	wrongID := msg
+	wrongID.Header.ID++
+	wrongID.Answers = []dnsmessage.Resource{aRecord(msg.Questions[0].Name.String(), 300, "6.6.6.6")}
+	wrongQuestion := wrongID
+	wrongQuestion.Header.ID = msg.Header.ID
+	wrongQuestion.Questions = []dnsmessage.Question{{Name: dnsmessage.MustNewName("evil.test."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}}
+	for _, m := range []dnsmessage.Message{wrongID, wrongQuestion} {
+		if buf, err := m.Pack(); err == nil {
+			s.udp.WriteTo(buf, addr)
+		}
+	}
+	s.udp.WriteTo([]byte("garbage"), addr)
+}
+
+func (s *stubServer) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			out := s.answer(buf, false)
+			conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(out))))
+			conn.Write(out)
+		}()
+	}
+}
+
+func (s *stubServer) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+func aRecord(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: a},
+	}
+}
+
+func aaaaRecord(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AAAAResource{AAAA: aaaa},
+	}
+}
+
+func cnameRecord(name string, ttl uint32, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)},
+	}
+}
+
+// runStubServer starts a stub DNS server listening for UDP and TCP on the same local port.
+func runStubServer(t *testing.T, records ...dnsmessage.Resource) *stubServer {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	assert.NoError(t, err)
+	s := &stubServer{records: make(map[string][]dnsmessage.Resource), udp: udp, tcp: tcp}
+	for _, rr := range records {
+		name := strings.ToLower(rr.Header.Name.String())
+		s.records[name] = append(s.records[name], rr)
+	}
+	go s.serveUDP()
+	go s.serveTCP()
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+	return s
+}
+
+func TestUDPResolver(t *testing.T) {
+	s := runStubServer(t, aRecord("example.test.", 300, "93.184.216.34"), aRecord("example.test.", 60, "93.184.216.35"))
+	res, err := NewUDPResolver(s.Addr()).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, NoError, res.Status)
+	assert.Equal(t, []Answer{
+		{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"},
+		{Name: "example.test.", Type: A, TTL: 60, Data: "93.184.216.35"},
+	}, res.Answer)
+
+	res, err = NewUDPResolver(s.Addr()).Resolve(context.Background(), "missing.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, NXDomain, res.Status)
+}
+
+func TestUDPResolverTruncatedRetriesTCP(t *testing.T) {
+	s := runStubServer(t, aRecord("example.test.", 300, "93.184.216.34"))
+	s.truncate.Store(true)
+	res, err := NewUDPResolver(s.Addr()).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Len(t, res.Answer, 1)
+}
+
+func TestUDPResolverIgnoresStrayResponses(t *testing.T) {
+	s := runStubServer(t, aRecord("example.test.", 300, "93.184.216.34"))
+	s.stray.Store(true)
+	res, err := NewUDPResolver(s.Addr()).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}, res.Answer)
+}
+
+func TestUDPResolverAAAA(t *testing.T) {
+	s := runStubServer(t, aRecord("example.test.", 300, "93.184.216.34"), aaaaRecord("example.test.", 300, "2606:2800:220:1::248"))
+	res, err := NewUDPResolver(s.Addr()).Resolve(context.Background(), "example.test", AAAA)
+	assert.NoError(t, err)
+	assert.Equal(t, []Answer{{Name: "example.test.", Type: AAAA, TTL: 300, Data: "2606:2800:220:1::248"}}, res.Answer)
+}
+
+func TestTCPResolver(t *testing.T) {
+	s := runStubServer(t, cnameRecord("www.example.test.", 300, "example.test."), aRecord("example.test.", 300, "93.184.216.34"))
+	res, err := NewTCPResolver(s.Addr()).Resolve(context.Background(), "www.example.test", CNAME)
+	assert.NoError(t, err)
+	assert.Equal(t, []Answer{{Name: "www.example.test.", Type: CNAME, TTL: 300, Data: "example.test."}}, res.Answer)
+}
+
+func TestWireResolverTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = NewUDPResolver(conn.LocalAddr().String(), WithResolverTimeout(time.Millisecond*50)).Resolve(context.Background(), "example.test", A)
+	assert.Error(t, err)
+}
+
+func TestDoHResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/dns-json", r.Header.Get("accept"))
+		assert.Equal(t, "example.test", r.URL.Query().Get("name"))
+		assert.Equal(t, "1", r.URL.Query().Get("type"))
+		json.NewEncoder(w).Encode(Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}})
+	}))
+	defer srv.Close()
+	res, err := NewDoHResolver(srv.URL).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}, res.Answer)
+}
+
+func TestDoHResolverWireFormat(t *testing.T) {
+	stub := &stubServer{records: map[string][]dnsmessage.Resource{"example.test.": {aRecord("example.test.", 300, "93.184.216.34")}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/dns-message", r.Header.Get("accept"))
+		buf, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		assert.NoError(t, err)
+		w.Header().Set("content-type", "application/dns-message")
+		w.Write(stub.answer(buf, false))
+	}))
+	defer srv.Close()
+	res, err := NewDoHResolver(srv.URL, WithWireFormat()).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}, res.Answer)
+}
+
+func TestDoHResolverBadStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	_, err := NewDoHResolver(srv.URL).Resolve(context.Background(), "example.test", A)
+	assert.EqualError(t, err, "unexpected status code: 502")
+}
+
+// staticResolver is a fake resolver which is safe to change while lookups run in the background.
+type staticResolver struct {
+	res   *Result
+	err   error
+	calls int
+	mutex sync.Mutex
+}
+
+func (r *staticResolver) Resolve(ctx context.Context, name string, qtype RecordType) (*Result, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls++
+	return r.res, r.err
+}
+
+// set changes the result returned by the resolver.
+func (r *staticResolver) set(res *Result, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.res, r.err = res, err
+}
+
+// callCount returns the number of times the resolver was called.
+func (r *staticResolver) callCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.calls
+}
+
+func TestFailoverResolver(t *testing.T) {
+	down := &staticResolver{err: errors.New("connection refused")}
+	servfail := &staticResolver{res: &Result{Status: ServFail}}
+	nxdomain := &staticResolver{res: &Result{Status: NXDomain}}
+	last := &staticResolver{res: &Result{Status: NoError}}
+	res, err := NewFailoverResolver(down, servfail, nxdomain, last).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, NXDomain, res.Status)
+	assert.Equal(t, 1, down.callCount())
+	assert.Equal(t, 1, servfail.callCount())
+	assert.Equal(t, 0, last.callCount())
+
+	_, err = NewFailoverResolver(down, servfail).Resolve(context.Background(), "example.test", A)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.ErrorContains(t, err, "Server Fail")
+
+	res, err = NewFailoverResolver().Resolve(context.Background(), "example.test", A)
+	assert.ErrorIs(t, err, errNoResolvers)
+	assert.Nil(t, res)
+}
+
+func TestGoogleResolverURL(t *testing.T) {
+	assert.Equal(t, GoogleURL, GoogleResolver().(*dohResolver).url)
+	assert.Equal(t, GoogleWireURL, GoogleResolver(WithWireFormat()).(*dohResolver).url)
+}
+
+func TestLookupWithStubServer(t *testing.T) {
+	s := runStubServer(t, aRecord("example.test.", 300, "93.184.216.34"), aRecord("private.test.", 300, "10.0.0.1"))
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	d := New(c, WithFailIfLocal(), WithResolvers(&staticResolver{err: errors.New("down")}, NewUDPResolver(s.Addr())))
+	ok, ip, err := d.Lookup(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "93.184.216.34", ip.String())
+	found, ttl, err := c.TTL("dns:example.test")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 5*time.Minute, ttl.Round(time.Second))
+
+	_, _, err = d.Lookup(context.Background(), "private.test")
+	assert.ErrorIs(t, err, ErrInvalidIP)
+
+	_, _, err = d.Lookup(context.Background(), "missing.test")
+	assert.EqualError(t, err, "dns lookup failed: Non-Existent Domain")
+}
+
+func TestSystemResolver(t *testing.T) {
+	s := runStubServer(t, aRecord("example.test.", 300, "93.184.216.34"))
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, s.Addr())
+		},
+	}
+	res, err := NewSystemResolver(resolver).Resolve(context.Background(), "example.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, []Answer{{Name: "example.test.", Type: A, TTL: systemTTL, Data: "93.184.216.34"}}, res.Answer)
+	res, err = NewSystemResolver(resolver).Resolve(context.Background(), "missing.test", A)
+	assert.NoError(t, err)
+	assert.Equal(t, NXDomain, res.Status)
+}
+
+func TestParseResponseAuthority(t *testing.T) {
+	query := dnsQuery{id: 1, question: dnsmessage.Question{Name: dnsmessage.MustNewName("missing.test."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 1, Response: true, RCode: dnsmessage.RCodeNameError},
+		Questions: []dnsmessage.Question{query.question},
+		Authorities: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("test."), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 3600},
+			Body: &dnsmessage.SOAResource{
+				NS: dnsmessage.MustNewName("ns.test."), MBox: dnsmessage.MustNewName("hostmaster.test."),
+				Serial: 1, Refresh: 7200, Retry: 900, Expire: 1209600, MinTTL: 30,
+			},
+		}},
+	}
+	buf, err := msg.Pack()
+	assert.NoError(t, err)
+	res, _, err := parseResponse(buf, query)
+	assert.NoError(t, err)
+	assert.Equal(t, NXDomain, res.Status)
+	assert.Len(t, res.Authority, 1)
+	assert.Equal(t, "ns.test. hostmaster.test. 1 7200 900 1209600 30", res.Authority[0].Data)
+	assert.Equal(t, uint(30), soaTTL(res.Authority))
+}
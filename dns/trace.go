@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Observer receives the events of a DNS resolver for metrics. The methods are called synchronously (and
+// concurrently for the A and AAAA queries) so they should return quickly.
+type Observer interface {
+	// OnCacheHit is called when a lookup is answered from the cache (including negatively cached names).
+	OnCacheHit(hostname string)
+	// OnCacheMiss is called when a lookup isn't in the cache and is resolved by the upstream resolvers.
+	OnCacheMiss(hostname string)
+	// OnStale is called when expired addresses are returned because the upstream resolvers failed with err.
+	OnStale(hostname string, err error)
+	// OnUpstream is called after each query to the upstream resolvers. The status is only valid if err is nil.
+	OnUpstream(hostname string, qtype RecordType, status StatusType, latency time.Duration, err error)
+	// OnSelect is called when Lookup selects ip from the candidate addresses.
+	OnSelect(hostname string, ip net.IP, candidates int)
+}
+
+// LookupStartInfo is the information about a lookup which is starting.
+type LookupStartInfo struct {
+	Host string
+}
+
+// UpstreamDoneInfo is the information about a query to the upstream resolvers.
+type UpstreamDoneInfo struct {
+	Host    string
+	Type    RecordType
+	Status  StatusType
+	Latency time.Duration
+	Err     error
+}
+
+// LookupDoneInfo is the result of a lookup.
+type LookupDoneInfo struct {
+	Addrs  []net.IP
+	Cached bool // the result was returned from the cache
+	Err    error
+}
+
+// ClientTrace is a set of hooks called during a lookup in the style of httptrace.ClientTrace. Any of the
+// hooks may be nil.
+type ClientTrace struct {
+	// LookupStart is called when a lookup begins.
+	LookupStart func(info LookupStartInfo)
+	// UpstreamDone is called after each query to the upstream resolvers, possibly concurrently.
+	UpstreamDone func(info UpstreamDoneInfo)
+	// LookupDone is called when a lookup ends.
+	LookupDone func(info LookupDoneInfo)
+}
+
+type clientTraceKey struct{}
+
+// WithClientTrace returns a new context based on ctx which calls the hooks in trace for lookups using the context.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return context.WithValue(ctx, clientTraceKey{}, trace)
+}
+
+// ContextClientTrace returns the ClientTrace for the context or nil if there isn't one.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey{}).(*ClientTrace)
+	return trace
+}
@@ -0,0 +1,116 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+type testObserver struct {
+	mu       sync.Mutex
+	hits     int
+	misses   int
+	stale    int
+	upstream []StatusType
+	selected net.IP
+}
+
+var _ Observer = (*testObserver)(nil)
+
+func (o *testObserver) OnCacheHit(hostname string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.hits++
+}
+
+func (o *testObserver) OnCacheMiss(hostname string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.misses++
+}
+
+func (o *testObserver) OnStale(hostname string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stale++
+}
+
+func (o *testObserver) OnUpstream(hostname string, qtype RecordType, status StatusType, latency time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.upstream = append(o.upstream, status)
+}
+
+func (o *testObserver) OnSelect(hostname string, ip net.IP, candidates int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.selected = ip
+}
+
+func TestObserver(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	r := &staticResolver{res: &Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}}}
+	o := &testObserver{}
+	d := New(c, WithResolvers(r), WithObserver(o), WithServeStale(time.Minute))
+	ok, ip, err := d.Lookup(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, o.misses)
+	assert.Equal(t, 0, o.hits)
+	assert.Equal(t, []StatusType{NoError, NoError}, o.upstream)
+	assert.Equal(t, *ip, o.selected)
+
+	_, _, err = d.Lookup(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, o.hits)
+
+	expireAddresses(c, "example.test")
+	r.set(nil, errors.New("connection refused"))
+	_, _, err = d.Lookup(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, o.stale)
+	assert.Equal(t, 2, o.misses)
+}
+
+func TestClientTrace(t *testing.T) {
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	r := &staticResolver{res: &Result{Status: NoError, Answer: []Answer{{Name: "example.test.", Type: A, TTL: 300, Data: "93.184.216.34"}}}}
+	d := New(c, WithResolvers(r))
+	var mu sync.Mutex
+	var started []string
+	var upstream int
+	var done []LookupDoneInfo
+	ctx := WithClientTrace(context.Background(), &ClientTrace{
+		LookupStart: func(info LookupStartInfo) {
+			started = append(started, info.Host)
+		},
+		UpstreamDone: func(info UpstreamDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			upstream++
+		},
+		LookupDone: func(info LookupDoneInfo) {
+			done = append(done, info)
+		},
+	})
+	_, err := d.LookupAll(ctx, "example.test")
+	assert.NoError(t, err)
+	_, err = d.LookupAll(ctx, "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.test", "example.test"}, started)
+	assert.Equal(t, 2, upstream, "should only query the A and AAAA records once")
+	assert.Len(t, done, 2)
+	assert.False(t, done[0].Cached)
+	assert.True(t, done[1].Cached)
+	assert.Equal(t, "93.184.216.34", done[1].Addrs[0].String())
+
+	assert.Nil(t, ContextClientTrace(context.Background()))
+}
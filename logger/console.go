@@ -58,7 +58,7 @@ type consoleLogger struct {
 	errorLevelColor   string
 	errorMessageColor string
 	sink              Sink
-	logLevel          LogLevel
+	level             *LevelVar
 	sinkLogLevel      LogLevel
 }
 
@@ -106,7 +106,7 @@ func (c *consoleLogger) Clone(kv map[string]interface{}, sink Sink) *consoleLogg
 		errorLevelColor:   c.Default(c.errorMessageColor, RedBold),
 		errorMessageColor: c.Default(c.errorMessageColor, Red),
 		sink:              sink,
-		logLevel:          c.logLevel,
+		level:             c.level,
 		sinkLogLevel:      c.sinkLogLevel,
 	}
 }
@@ -134,10 +134,21 @@ func (c *consoleLogger) With(metadata map[string]interface{}) Logger {
 }
 
 func (c *consoleLogger) Log(level LogLevel, levelColor string, messageColor string, levelString string, msg string, args ...interface{}) {
-	if level < c.logLevel && level < c.sinkLogLevel {
+	if level < c.level.levelFor(c.prefixes) && level < c.sinkLogLevel {
 		return
 	}
-	_msg := fmt.Sprintf(msg, args...)
+	c.log(level, levelColor, messageColor, levelString, fmt.Sprintf(msg, args...), nil)
+}
+
+// LogKV logs the message as is with the key/value pairs rendered inline after it.
+func (c *consoleLogger) LogKV(level LogLevel, levelColor string, messageColor string, levelString string, msg string, keysAndValues ...interface{}) {
+	if level < c.level.levelFor(c.prefixes) && level < c.sinkLogLevel {
+		return
+	}
+	c.log(level, levelColor, messageColor, levelString, msg, keysAndValues)
+}
+
+func (c *consoleLogger) log(level LogLevel, levelColor string, messageColor string, levelString string, _msg string, keysAndValues []interface{}) {
 	var prefix string
 	var suffix string
 	if len(c.prefixes) > 0 {
@@ -160,8 +171,11 @@ func (c *consoleLogger) Log(level LogLevel, levelColor string, messageColor stri
 	}
 	levelText := color(levelColor) + fmt.Sprintf("[%s]%s", levelString, levelSuffix) + color(Reset)
 	message := color(messageColor) + _msg + color(Reset)
+	if len(keysAndValues) > 0 {
+		message += " " + color(Cyan) + formatKV(keysAndValues) + color(Reset)
+	}
 	out := fmt.Sprintf("%s %s%s%s", levelText, prefix, message, suffix)
-	if level >= c.logLevel {
+	if level >= c.level.levelFor(c.prefixes) {
 		log.Printf("%s\n", out)
 	}
 	if c.sink != nil && level >= c.sinkLogLevel {
@@ -195,16 +209,41 @@ func (c *consoleLogger) Fatal(msg string, args ...interface{}) {
 	os.Exit(1)
 }
 
+func (c *consoleLogger) TraceKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelTrace, c.traceLevelColor, c.traceMessageColor, "TRACE", msg, keysAndValues...)
+}
+
+func (c *consoleLogger) DebugKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelDebug, c.debugLevelColor, c.debugMessageColor, "DEBUG", msg, keysAndValues...)
+}
+
+func (c *consoleLogger) InfoKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelInfo, c.infoLevelColor, c.infoMessageColor, "INFO", msg, keysAndValues...)
+}
+
+func (c *consoleLogger) WarnKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelWarn, c.warnLevelColor, c.warnMessageColor, "WARN", msg, keysAndValues...)
+}
+
+func (c *consoleLogger) ErrorKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelError, c.errorLevelColor, c.errorMessageColor, "ERROR", msg, keysAndValues...)
+}
+
+// SetLogLevel sets the level of the logger and the loggers sharing its LevelVar.
 func (c *consoleLogger) SetLogLevel(level LogLevel) {
-	c.logLevel = level
+	c.level.Set(level)
 }
 
 // NewConsoleLogger returns a new Logger instance which will log to the console
 func NewConsoleLogger(levels ...LogLevel) SinkLogger {
 	if len(levels) > 0 {
-		return (&consoleLogger{logLevel: levels[0], sinkLogLevel: LevelNone}).Clone(nil, nil)
+		return NewConsoleLoggerWithLevel(NewLevelVar(levels[0]))
 	}
-	level := GetLevelFromEnv()
+	return NewConsoleLoggerWithLevel(NewLevelVar(GetLevelFromEnv()))
+}
 
-	return (&consoleLogger{logLevel: level, sinkLogLevel: LevelNone}).Clone(nil, nil)
+// NewConsoleLoggerWithLevel returns a new Logger instance which will log to the console using the level which
+// can be changed while it is running
+func NewConsoleLoggerWithLevel(level *LevelVar) SinkLogger {
+	return (&consoleLogger{level: level, sinkLogLevel: LevelNone}).Clone(nil, nil)
 }
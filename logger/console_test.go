@@ -11,9 +11,10 @@ import (
 
 func captureOutput(f func()) string {
 	var buf bytes.Buffer
+	prev := log.Writer()
+	defer log.SetOutput(prev)
 	log.SetOutput(&buf)
 	f()
-	log.SetOutput(nil)
 	return buf.String()
 }
 
@@ -293,3 +294,15 @@ func TestConsoleLoggerSinkErrorLevel(t *testing.T) {
 	})
 	assert.Contains(t, output, "This is an error message")
 }
+
+func TestConsoleLoggerKV(t *testing.T) {
+	logger := NewConsoleLogger(LevelInfo).With(map[string]interface{}{"key1": "value1"})
+	output := captureOutput(func() {
+		logger.InfoKV("request done", "status", 200, "path", "/a b")
+		logger.DebugKV("skipped", "a", 1)
+	})
+	assert.Contains(t, output, `request done`)
+	assert.Contains(t, output, `status=200 path="/a b"`)
+	assert.Contains(t, output, `"key1":"value1"`)
+	assert.NotContains(t, output, "skipped")
+}
@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// metadata keys set from the span in the context which the JSON logger writes to the Cloud Logging fields
+const (
+	TraceKey        = "trace"
+	SpanIDKey       = "spanId"
+	TraceSampledKey = "trace_sampled"
+)
+
+var defaultLogger = sync.OnceValue(func() Logger {
+	return NewConsoleLogger()
+})
+
+// WithContext returns a copy of the context which carries the logger.
+func WithContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger from the context, or a console logger if there isn't one. If the context has
+// an OpenTelemetry span the logger has the trace and span ids so the logs are correlated with the trace.
+func FromContext(ctx context.Context) Logger {
+	logger, ok := ctx.Value(contextKey{}).(Logger)
+	if !ok {
+		logger = defaultLogger()
+	}
+	if kv := TraceMetadata(ctx); kv != nil {
+		return logger.With(kv)
+	}
+	return logger
+}
+
+// TraceMetadata returns the trace metadata for the OpenTelemetry span in the context or nil if there isn't one.
+// The trace is in the projects/<project>/traces/<trace id> form used by Cloud Logging when the
+// GOOGLE_CLOUD_PROJECT environment variable is set.
+func TraceMetadata(ctx context.Context) map[string]interface{} {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	traceID := sc.TraceID().String()
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		traceID = "projects/" + project + "/traces/" + traceID
+	}
+	return map[string]interface{}{
+		TraceKey:        traceID,
+		SpanIDKey:       sc.SpanID().String(),
+		TraceSampledKey: sc.IsSampled(),
+	}
+}
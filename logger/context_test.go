@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.NotNil(t, FromContext(context.Background()), "should return a default logger")
+	log := NewTestLogger()
+	ctx := WithContext(context.Background(), log)
+	assert.Equal(t, log, FromContext(ctx))
+	FromContext(ctx).Info("hi")
+	assert.Len(t, log.Logs, 1)
+}
+
+func TestFromContextWithSpan(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "my-project")
+	sink := &testSink{}
+	ctx := WithContext(context.Background(), NewJSONLoggerWithSink(sink, LevelTrace))
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	log := FromContext(ctx)
+	tv := time.Date(2023, 10, 22, 12, 30, 0, 0, time.UTC)
+	log.(*jsonLogger).ts = &tv
+	log.Info("hi")
+	assert.Equal(t, `{"timestamp":"2023-10-22T12:30:00Z","message":"hi","severity":"INFO","logging.googleapis.com/trace":"projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736","logging.googleapis.com/spanId":"00f067aa0ba902b7","logging.googleapis.com/trace_sampled":true}`, string(sink.buf))
+}
+
+func TestJSONLoggerWithDoesntChangeMetadata(t *testing.T) {
+	metadata := map[string]interface{}{TraceKey: "trace", SpanIDKey: "span", TraceSampledKey: true, "component": "test", "key": "value"}
+	NewJSONLoggerWithSink(&testSink{}, LevelTrace).With(metadata)
+	assert.Len(t, metadata, 5, "the caller's metadata shouldn't be changed")
+}
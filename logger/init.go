@@ -4,7 +4,6 @@ import (
 	"io"
 	"os"
 	"regexp"
-	"strings"
 )
 
 // LogLevel defines the level of logging
@@ -21,23 +20,8 @@ const (
 
 // GetLevelFrom env will look at the environment var `SM_LOG_LEVEL` and convert it into the appropriate LogLevel
 func GetLevelFromEnv() LogLevel {
-	s := os.Getenv("SM_LOG_LEVEL")
-	switch strings.ToLower(s) { // Convert the string to lowercase to make it case-insensitive
-	case "none":
-		return LevelNone
-	case "trace":
-		return LevelTrace
-	case "debug":
-		return LevelDebug
-	case "info":
-		return LevelInfo
-	case "warn":
-		return LevelWarn
-	case "error":
-		return LevelError
-	default:
-		return LevelDebug // Return an unknown or default value for invalid strings
-	}
+	level, _ := ParseLevel(os.Getenv("SM_LOG_LEVEL")) // invalid values default to debug
+	return level
 }
 
 type Sink io.Writer
@@ -60,6 +44,16 @@ type Logger interface {
 	Error(msg string, args ...interface{})
 	// Fatal level logging and exit with code 1
 	Fatal(msg string, args ...interface{})
+	// TraceKV logs the message at trace level with alternating key/value pairs as fields
+	TraceKV(msg string, keysAndValues ...interface{})
+	// DebugKV logs the message at debug level with alternating key/value pairs as fields
+	DebugKV(msg string, keysAndValues ...interface{})
+	// InfoKV logs the message at info level with alternating key/value pairs as fields
+	InfoKV(msg string, keysAndValues ...interface{})
+	// WarnKV logs the message at warning level with alternating key/value pairs as fields
+	WarnKV(msg string, keysAndValues ...interface{})
+	// ErrorKV logs the message at error level with alternating key/value pairs as fields
+	ErrorKV(msg string, keysAndValues ...interface{})
 }
 
 type SinkLogger interface {
@@ -17,6 +17,8 @@ type JSONLogEntry struct {
 	Message   string                 `json:"message"`
 	Severity  string                 `json:"severity,omitempty"`
 	Trace     string                 `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID    string                 `json:"logging.googleapis.com/spanId,omitempty"`
+	Sampled   bool                   `json:"logging.googleapis.com/trace_sampled,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
 	// Logs Explorer allows filtering and display of this as `jsonPayload.component`.
 	Component string `json:"component,omitempty"`
@@ -38,12 +40,14 @@ func (e JSONLogEntry) String() string {
 type jsonLogger struct {
 	metadata     map[string]interface{}
 	traceID      string
+	spanID       string
+	sampled      bool
 	component    string
 	sink         Sink
 	sinkLogLevel LogLevel
 	noConsole    bool
 	ts           *time.Time // for unit testing
-	logLevel     LogLevel
+	level        *LevelVar
 }
 
 var _ Logger = (*jsonLogger)(nil)
@@ -68,24 +72,32 @@ func (c *jsonLogger) WithPrefix(prefix string) Logger {
 
 func (c *jsonLogger) With(metadata map[string]interface{}) Logger {
 	traceID := c.traceID
+	spanID := c.spanID
+	sampled := c.sampled
 	component := c.component
-	if trace, ok := metadata["trace"].(string); ok {
+	// copy the metadata so the special keys can be removed without changing the caller's map
+	kv := make(map[string]interface{}, len(c.metadata)+len(metadata))
+	for k, v := range c.metadata {
+		kv[k] = v
+	}
+	for k, v := range metadata {
+		kv[k] = v
+	}
+	if trace, ok := metadata[TraceKey].(string); ok {
 		traceID = trace
-		delete(metadata, "trace")
+		delete(kv, TraceKey)
+	}
+	if span, ok := metadata[SpanIDKey].(string); ok {
+		spanID = span
+		delete(kv, SpanIDKey)
+	}
+	if s, ok := metadata[TraceSampledKey].(bool); ok {
+		sampled = s
+		delete(kv, TraceSampledKey)
 	}
 	if comp, ok := metadata["component"].(string); ok {
 		component = comp
-		delete(metadata, "component")
-	}
-	kv := metadata
-	if c.metadata != nil {
-		kv = make(map[string]interface{})
-		for k, v := range c.metadata {
-			kv[k] = v
-		}
-		for k, v := range metadata {
-			kv[k] = v
-		}
+		delete(kv, "component")
 	}
 	if len(kv) == 0 {
 		kv = nil
@@ -93,11 +105,13 @@ func (c *jsonLogger) With(metadata map[string]interface{}) Logger {
 	return &jsonLogger{
 		metadata:     kv,
 		traceID:      traceID,
+		spanID:       spanID,
+		sampled:      sampled,
 		component:    component,
 		noConsole:    c.noConsole,
 		sink:         c.sink,
 		sinkLogLevel: c.sinkLogLevel,
-		logLevel:     c.logLevel,
+		level:        c.level,
 	}
 }
 
@@ -115,22 +129,44 @@ func (c *jsonLogger) tokenize(val string) string {
 }
 
 func (c *jsonLogger) Log(level LogLevel, severity string, msg string, args ...interface{}) {
-	if level < c.logLevel && level < c.sinkLogLevel {
+	if level < c.logLevel() && level < c.sinkLogLevel {
 		return
 	}
 	_msg := msg
 	if len(args) > 0 {
 		_msg = fmt.Sprintf(msg, args...)
 	}
+	c.log(level, severity, _msg, c.metadata)
+}
+
+// LogKV logs the message as is with the key/value pairs added to the metadata.
+func (c *jsonLogger) LogKV(level LogLevel, severity string, msg string, keysAndValues ...interface{}) {
+	if level < c.logLevel() && level < c.sinkLogLevel {
+		return
+	}
+	metadata := mergeKV(c.metadata, keysAndValues)
+	if len(keysAndValues) > 0 {
+		for k, v := range metadata {
+			if err, ok := v.(error); ok {
+				metadata[k] = err.Error() // most errors marshal to {}
+			}
+		}
+	}
+	c.log(level, severity, msg, metadata)
+}
+
+func (c *jsonLogger) log(level LogLevel, severity string, _msg string, metadata map[string]interface{}) {
 	entry := JSONLogEntry{
 		Severity:  severity,
 		Message:   _msg,
 		Trace:     c.traceID,
-		Metadata:  c.metadata,
+		SpanID:    c.spanID,
+		Sampled:   c.sampled,
+		Metadata:  metadata,
 		Component: c.tokenize(c.component),
 		Timestamp: time.Now(),
 	}
-	if !c.noConsole && level >= c.logLevel {
+	if !c.noConsole && level >= c.logLevel() {
 		log.Println(entry)
 	}
 	if c.sink != nil && level >= c.sinkLogLevel {
@@ -169,21 +205,51 @@ func (c *jsonLogger) Fatal(msg string, args ...interface{}) {
 	c.Log(LevelError, "ERROR", msg, args...)
 }
 
+func (c *jsonLogger) TraceKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelTrace, "TRACE", msg, keysAndValues...)
+}
+
+func (c *jsonLogger) DebugKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelDebug, "DEBUG", msg, keysAndValues...)
+}
+
+func (c *jsonLogger) InfoKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelInfo, "INFO", msg, keysAndValues...)
+}
+
+func (c *jsonLogger) WarnKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelWarn, "WARNING", msg, keysAndValues...)
+}
+
+func (c *jsonLogger) ErrorKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV(LevelError, "ERROR", msg, keysAndValues...)
+}
+
+// SetLogLevel sets the level of the logger and the loggers sharing its LevelVar.
 func (c *jsonLogger) SetLogLevel(level LogLevel) {
-	c.logLevel = level
+	c.level.Set(level)
+}
+
+// logLevel returns the level for the logger's component.
+func (c *jsonLogger) logLevel() LogLevel {
+	return c.level.levelFor(strings.Fields(c.component))
 }
 
 // NewJSONLogger returns a new Logger instance which can be used for structured logging
 func NewJSONLogger(levels ...LogLevel) Logger {
 	if len(levels) > 0 {
-		return &jsonLogger{logLevel: levels[0]}
+		return NewJSONLoggerWithLevel(NewLevelVar(levels[0]))
 	}
-	level := GetLevelFromEnv()
-	return &jsonLogger{logLevel: level}
+	return NewJSONLoggerWithLevel(NewLevelVar(GetLevelFromEnv()))
+}
 
+// NewJSONLoggerWithLevel returns a new Logger instance which can be used for structured logging using the level
+// which can be changed while it is running
+func NewJSONLoggerWithLevel(level *LevelVar) Logger {
+	return &jsonLogger{level: level}
 }
 
 // NewJSONLoggerWithSink returns a new Logger instance using a sink and suppressing the console logging
 func NewJSONLoggerWithSink(sink Sink, level LogLevel) SinkLogger {
-	return &jsonLogger{noConsole: true, sink: sink, sinkLogLevel: level}
+	return &jsonLogger{noConsole: true, sink: sink, sinkLogLevel: level, level: NewLevelVar(LevelTrace)}
 }
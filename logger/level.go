@@ -0,0 +1,199 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// String returns the lowercase name of the level as used by SM_LOG_LEVEL.
+func (l LogLevel) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelNone:
+		return "none"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the LogLevel for the name (case-insensitive).
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return LevelNone, nil
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelDebug, fmt.Errorf("invalid log level: %q", s)
+}
+
+// LevelVar is a log level which can be changed while the loggers using it are running. A logger and the loggers
+// created from it with With and WithPrefix share the same LevelVar. It is safe for concurrent use.
+type LevelVar struct {
+	level     atomic.Int32
+	overrides atomic.Pointer[map[string]LogLevel] // copied on write so reads don't lock
+	mutex     sync.Mutex
+}
+
+// NewLevelVar returns a new LevelVar set to the level.
+func NewLevelVar(level LogLevel) *LevelVar {
+	v := &LevelVar{}
+	v.Set(level)
+	return v
+}
+
+// Level returns the level for loggers without an override.
+func (v *LevelVar) Level() LogLevel {
+	return LogLevel(v.level.Load())
+}
+
+// Set changes the level for loggers without an override.
+func (v *LevelVar) Set(level LogLevel) {
+	v.level.Store(int32(level))
+}
+
+// normalizePrefix returns the prefix without the brackets used by console prefixes such as [sync].
+func normalizePrefix(prefix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(prefix, "["), "]")
+}
+
+// SetOverride sets the level for loggers with the prefix, which takes precedence over the level.
+func (v *LevelVar) SetOverride(prefix string, level LogLevel) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	overrides := v.Overrides()
+	overrides[normalizePrefix(prefix)] = level
+	v.overrides.Store(&overrides)
+}
+
+// ClearOverride removes the level override for the prefix.
+func (v *LevelVar) ClearOverride(prefix string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	overrides := v.Overrides()
+	delete(overrides, normalizePrefix(prefix))
+	v.overrides.Store(&overrides)
+}
+
+// Overrides returns a copy of the level overrides by prefix.
+func (v *LevelVar) Overrides() map[string]LogLevel {
+	overrides := make(map[string]LogLevel)
+	if current := v.overrides.Load(); current != nil {
+		for k, l := range *current {
+			overrides[k] = l
+		}
+	}
+	return overrides
+}
+
+// levelFor returns the level for a logger with the prefixes. The override for the last (most specific) prefix wins.
+func (v *LevelVar) levelFor(prefixes []string) LogLevel {
+	if overrides := v.overrides.Load(); overrides != nil && len(*overrides) > 0 {
+		for i := len(prefixes) - 1; i >= 0; i-- {
+			if level, ok := (*overrides)[normalizePrefix(prefixes[i])]; ok {
+				return level
+			}
+		}
+	}
+	return v.Level()
+}
+
+type levelState struct {
+	Level     string            `json:"level"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// NewLevelHandler returns an http.Handler which shows and changes the levels. GET returns the levels as JSON,
+// PUT or POST with ?level=debug sets the level (or the override with &prefix=sync) and DELETE with ?prefix=sync
+// removes the override.
+func NewLevelHandler(v *LevelVar) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			level, err := ParseLevel(r.URL.Query().Get("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if prefix != "" {
+				v.SetOverride(prefix, level)
+			} else {
+				v.Set(level)
+			}
+		case http.MethodDelete:
+			if prefix == "" {
+				http.Error(w, "prefix is required", http.StatusBadRequest)
+				return
+			}
+			v.ClearOverride(prefix)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		state := levelState{Level: v.Level().String()}
+		if overrides := v.Overrides(); len(overrides) > 0 {
+			state.Overrides = make(map[string]string, len(overrides))
+			for k, l := range overrides {
+				state.Overrides[k] = l.String()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	})
+}
+
+// ToggleDebugOnSignal switches the level to debug when the process receives SIGUSR1 and back to the exact previous
+// level on the next SIGUSR1 until the context is done. The changes are logged with the logger from the context
+// (see WithContext). It does nothing on windows.
+func ToggleDebugOnSignal(ctx context.Context, v *LevelVar) {
+	c := make(chan os.Signal, 1)
+	notifyToggle(c)
+	go func() {
+		defer signal.Stop(c)
+		var previous LogLevel
+		var debugging bool
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c:
+				if debugging {
+					// log before restoring the level so the message isn't filtered out
+					FromContext(ctx).Info("log level changed from %s to %s", v.Level(), previous)
+					v.Set(previous)
+				} else {
+					previous = v.Level()
+					v.Set(LevelDebug)
+					FromContext(ctx).Info("log level changed from %s to %s", previous, LevelDebug)
+				}
+				debugging = !debugging
+			}
+		}
+	}()
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelVarSharedByChildren(t *testing.T) {
+	level := NewLevelVar(LevelInfo)
+	log := NewConsoleLoggerWithLevel(level)
+	child := log.With(map[string]interface{}{"a": 1}).WithPrefix("[sync]")
+	output := captureOutput(func() {
+		child.Debug("hidden")
+		level.Set(LevelDebug)
+		child.Debug("shown")
+	})
+	assert.NotContains(t, output, "hidden")
+	assert.Contains(t, output, "shown")
+}
+
+func TestLevelVarOverrides(t *testing.T) {
+	level := NewLevelVar(LevelInfo)
+	level.SetOverride("sync", LevelTrace)
+	assert.Equal(t, map[string]LogLevel{"sync": LevelTrace}, level.Overrides())
+
+	jlog := NewJSONLoggerWithLevel(level)
+	output := captureOutput(func() {
+		jlog.Debug("base")
+		jlog.WithPrefix("[other]").WithPrefix("[sync]").Trace("synced")
+	})
+	assert.NotContains(t, output, "base")
+	assert.Contains(t, output, `"message":"synced"`)
+
+	console := NewConsoleLoggerWithLevel(level)
+	output = captureOutput(func() {
+		console.Debug("base")
+		console.WithPrefix("[sync]").Trace("synced")
+	})
+	assert.NotContains(t, output, "base")
+	assert.Contains(t, output, "synced")
+
+	level.ClearOverride("[sync]")
+	output = captureOutput(func() {
+		console.WithPrefix("[sync]").Trace("synced")
+	})
+	assert.Empty(t, output)
+}
+
+func TestLevelHandler(t *testing.T) {
+	level := NewLevelVar(LevelInfo)
+	handler := NewLevelHandler(level)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"info"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/?level=debug", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, LevelDebug, level.Level())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?level=trace&prefix=sync", nil))
+	assert.JSONEq(t, `{"level":"debug","overrides":{"sync":"trace"}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/?prefix=sync", nil))
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/?level=loud", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, LevelDebug, level.Level())
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []LogLevel{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelNone} {
+		parsed, err := ParseLevel(level.String())
+		assert.NoError(t, err)
+		assert.Equal(t, level, parsed)
+	}
+	_, err := ParseLevel("loud")
+	assert.Error(t, err)
+}
+
+func waitForLevel(t *testing.T, v *LevelVar, level LogLevel) {
+	assert.Eventually(t, func() bool { return v.Level() == level }, time.Second, time.Millisecond)
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -157,3 +158,30 @@ func TestJSONLoggerWithEnvLevel(t *testing.T) {
 		os.Unsetenv("SM_LOG_LEVEL")
 	}
 }
+
+func TestJSONLoggerKV(t *testing.T) {
+	sink := &testSink{}
+	log := NewJSONLoggerWithSink(sink, LevelDebug).With(map[string]interface{}{"service": "api"})
+	tv := time.Date(2023, 10, 22, 12, 30, 0, 0, time.UTC)
+	log.(*jsonLogger).ts = &tv
+	log.InfoKV("request done", "status", 200, "err", errors.New("boom"), "dangling")
+	assert.Equal(t, `{"timestamp":"2023-10-22T12:30:00Z","message":"request done","severity":"INFO","metadata":{"!BADKEY":"dangling","err":"boom","service":"api","status":200}}`, string(sink.buf))
+	log.InfoKV("100%", "a", 1)
+	assert.Contains(t, string(sink.buf), `"message":"100%"`, "shouldn't format the message")
+	sink.buf = nil
+	log.TraceKV("skipped", "a", 1)
+	assert.Nil(t, sink.buf)
+	log.Info("no fields")
+	assert.Equal(t, `{"timestamp":"2023-10-22T12:30:00Z","message":"no fields","severity":"INFO","metadata":{"service":"api"}}`, string(sink.buf))
+}
+
+func TestCombinedLoggerKV(t *testing.T) {
+	log := NewTestLogger()
+	other := NewTestLogger()
+	combined := NewMultiLogger(log, other)
+	combined.WarnKV("slow", "ms", 1500)
+	assert.Len(t, log.Logs, 1)
+	assert.Len(t, other.Logs, 1)
+	assert.Equal(t, "WARNING", log.Logs[0].Severity)
+	assert.Equal(t, map[string]interface{}{"ms": 1500}, log.Logs[0].Fields)
+}
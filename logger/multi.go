@@ -44,6 +44,26 @@ func (m *muxLogger) Fatal(msg string, args ...interface{}) {
 	m.each(func(l Logger) { l.Fatal(msg, args...) })
 }
 
+func (m *muxLogger) TraceKV(msg string, keysAndValues ...interface{}) {
+	m.each(func(l Logger) { l.TraceKV(msg, keysAndValues...) })
+}
+
+func (m *muxLogger) DebugKV(msg string, keysAndValues ...interface{}) {
+	m.each(func(l Logger) { l.DebugKV(msg, keysAndValues...) })
+}
+
+func (m *muxLogger) InfoKV(msg string, keysAndValues ...interface{}) {
+	m.each(func(l Logger) { l.InfoKV(msg, keysAndValues...) })
+}
+
+func (m *muxLogger) WarnKV(msg string, keysAndValues ...interface{}) {
+	m.each(func(l Logger) { l.WarnKV(msg, keysAndValues...) })
+}
+
+func (m *muxLogger) ErrorKV(msg string, keysAndValues ...interface{}) {
+	m.each(func(l Logger) { l.ErrorKV(msg, keysAndValues...) })
+}
+
 func (m *muxLogger) each(f func(Logger)) {
 	for _, l := range m.loggers {
 		f(l)
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyToggle(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
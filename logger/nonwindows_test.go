@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package logger
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToggleDebugOnSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	level := NewLevelVar(LevelWarn)
+	ToggleDebugOnSignal(ctx, level)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitForLevel(t, level, LevelDebug)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitForLevel(t, level, LevelWarn)
+}
+
+func TestToggleDebugOnSignalRestoresTrace(t *testing.T) {
+	log := NewTestLogger()
+	ctx, cancel := context.WithCancel(WithContext(context.Background(), log))
+	defer cancel()
+	level := NewLevelVar(LevelTrace)
+	ToggleDebugOnSignal(ctx, level)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitForLevel(t, level, LevelDebug)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitForLevel(t, level, LevelTrace)
+	// the second message is logged before the level is restored so both are visible here
+	assert.Len(t, log.Logs, 2)
+	assert.Equal(t, []interface{}{LevelTrace, LevelDebug}, log.Logs[0].Arguments)
+	assert.Equal(t, []interface{}{LevelDebug, LevelTrace}, log.Logs[1].Arguments)
+}
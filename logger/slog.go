@@ -0,0 +1,278 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SlogLevelTrace is the slog level used for LevelTrace, below slog.LevelDebug.
+const SlogLevelTrace = slog.Level(-8)
+
+// ToSlogLevel returns the slog level for the LogLevel.
+func ToSlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelTrace:
+		return SlogLevelTrace
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelError + 4 // LevelNone
+}
+
+// FromSlogLevel returns the LogLevel for the slog level. Levels between the slog levels round down.
+func FromSlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelDebug:
+		return LevelTrace
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	}
+	return LevelError
+}
+
+type slogHandler struct {
+	logger Logger
+	level  slog.Leveler
+	attrs  map[string]interface{}
+	groups []string
+}
+
+var _ slog.Handler = (*slogHandler)(nil)
+
+// NewSlogHandler returns a slog.Handler which logs to the logger. Attributes are logged as metadata and groups
+// as nested maps. Records logged with a context which has an OpenTelemetry span include the trace metadata.
+// Records below level are dropped before they reach the logger, a nil level sends every record and leaves the
+// filtering to the logger.
+func NewSlogHandler(logger Logger, level slog.Leveler) slog.Handler {
+	return &slogHandler{logger: logger, level: level}
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.level == nil || level >= h.level.Level()
+}
+
+// group returns the map for the open groups in kv, creating it if needed.
+func (h *slogHandler) group(kv map[string]interface{}) map[string]interface{} {
+	for _, name := range h.groups {
+		child, ok := kv[name].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			kv[name] = child
+		}
+		kv = child
+	}
+	return kv
+}
+
+// addAttr adds the attribute to kv following the slog rules for empty attributes and groups.
+func addAttr(kv map[string]interface{}, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() != slog.KindGroup {
+		kv[attr.Key] = attr.Value.Any()
+		return
+	}
+	attrs := attr.Value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+	if attr.Key == "" {
+		// a group without a key is inlined
+		for _, a := range attrs {
+			addAttr(kv, a)
+		}
+		return
+	}
+	child, ok := kv[attr.Key].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		kv[attr.Key] = child
+	}
+	for _, a := range attrs {
+		addAttr(child, a)
+	}
+}
+
+// copyAttrs returns a deep copy of the attributes so nested groups can be added to without changing h.
+func copyAttrs(attrs map[string]interface{}) map[string]interface{} {
+	kv := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		if child, ok := v.(map[string]interface{}); ok {
+			v = copyAttrs(child)
+		}
+		kv[k] = v
+	}
+	return kv
+}
+
+func (h *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	kv := copyAttrs(h.attrs)
+	group := h.group(kv)
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(group, attr)
+		return true
+	})
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		if child, ok := kv[k].(map[string]interface{}); ok && len(child) == 0 {
+			continue // a group without any attributes is omitted
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	keysAndValues := make([]interface{}, 0, len(keys)*2)
+	for _, k := range keys {
+		keysAndValues = append(keysAndValues, k, kv[k])
+	}
+	logger := h.logger
+	if trace := TraceMetadata(ctx); trace != nil {
+		// correlate the record with the span in the context like FromContext
+		logger = logger.With(trace)
+	}
+	switch FromSlogLevel(record.Level) {
+	case LevelTrace:
+		logger.TraceKV(record.Message, keysAndValues...)
+	case LevelDebug:
+		logger.DebugKV(record.Message, keysAndValues...)
+	case LevelInfo:
+		logger.InfoKV(record.Message, keysAndValues...)
+	case LevelWarn:
+		logger.WarnKV(record.Message, keysAndValues...)
+	default:
+		logger.ErrorKV(record.Message, keysAndValues...)
+	}
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	kv := copyAttrs(h.attrs)
+	group := h.group(kv)
+	for _, attr := range attrs {
+		addAttr(group, attr)
+	}
+	return &slogHandler{logger: h.logger, level: h.level, attrs: kv, groups: h.groups}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := make([]string, 0, len(h.groups)+1)
+	groups = append(groups, h.groups...)
+	return &slogHandler{logger: h.logger, level: h.level, attrs: h.attrs, groups: append(groups, name)}
+}
+
+type slogLogger struct {
+	logger   *slog.Logger
+	prefixes []string
+}
+
+var _ Logger = (*slogLogger)(nil)
+
+// NewSlogLogger returns a Logger which logs to the slog logger. Metadata is logged as attributes and the
+// prefixes are logged in the component attribute.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (s *slogLogger) With(metadata map[string]interface{}) Logger {
+	if len(metadata) == 0 {
+		return s
+	}
+	args := make([]interface{}, 0, len(metadata)*2)
+	for k, v := range metadata {
+		args = append(args, k, v)
+	}
+	return &slogLogger{logger: s.logger.With(args...), prefixes: s.prefixes}
+}
+
+// WithPrefix will return a new logger with a prefix prepended to the message
+func (s *slogLogger) WithPrefix(prefix string) Logger {
+	prefix = strings.TrimSuffix(strings.TrimPrefix(prefix, "["), "]")
+	for _, p := range s.prefixes {
+		if p == prefix {
+			return s
+		}
+	}
+	prefixes := make([]string, 0, len(s.prefixes)+1)
+	prefixes = append(prefixes, s.prefixes...)
+	return &slogLogger{logger: s.logger, prefixes: append(prefixes, prefix)}
+}
+
+func (s *slogLogger) log(level slog.Level, msg string, args []interface{}, keysAndValues []interface{}) {
+	ctx := context.Background()
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	if len(s.prefixes) > 0 {
+		keysAndValues = append([]interface{}{"component", strings.Join(s.prefixes, ", ")}, keysAndValues...)
+	}
+	s.logger.Log(ctx, level, msg, keysAndValues...)
+}
+
+func (s *slogLogger) Trace(msg string, args ...interface{}) {
+	s.log(SlogLevelTrace, msg, args, nil)
+}
+
+func (s *slogLogger) Debug(msg string, args ...interface{}) {
+	s.log(slog.LevelDebug, msg, args, nil)
+}
+
+func (s *slogLogger) Info(msg string, args ...interface{}) {
+	s.log(slog.LevelInfo, msg, args, nil)
+}
+
+func (s *slogLogger) Warn(msg string, args ...interface{}) {
+	s.log(slog.LevelWarn, msg, args, nil)
+}
+
+func (s *slogLogger) Error(msg string, args ...interface{}) {
+	s.log(slog.LevelError, msg, args, nil)
+}
+
+func (s *slogLogger) Fatal(msg string, args ...interface{}) {
+	s.log(slog.LevelError, msg, args, nil)
+	os.Exit(1)
+}
+
+func (s *slogLogger) TraceKV(msg string, keysAndValues ...interface{}) {
+	s.log(SlogLevelTrace, msg, nil, keysAndValues)
+}
+
+func (s *slogLogger) DebugKV(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelDebug, msg, nil, keysAndValues)
+}
+
+func (s *slogLogger) InfoKV(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelInfo, msg, nil, keysAndValues)
+}
+
+func (s *slogLogger) WarnKV(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelWarn, msg, nil, keysAndValues)
+}
+
+func (s *slogLogger) ErrorKV(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelError, msg, nil, keysAndValues)
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSlogHandler(t *testing.T) {
+	sink := &testSink{}
+	jlog := NewJSONLoggerWithSink(sink, LevelTrace)
+	tv := time.Date(2023, 10, 22, 12, 30, 0, 0, time.UTC)
+	jlog.(*jsonLogger).ts = &tv
+	log := slog.New(NewSlogHandler(jlog, nil))
+
+	log.Log(context.Background(), SlogLevelTrace, "tracing", "a", 1)
+	assert.Equal(t, `{"timestamp":"2023-10-22T12:30:00Z","message":"tracing","severity":"TRACE","metadata":{"a":1}}`, string(sink.buf))
+
+	log.With("service", "api").WithGroup("http").With("method", "GET").Warn("slow", "status", 200, slog.Group("timing", "ms", 5), slog.Group("empty"))
+	assert.Equal(t, `{"timestamp":"2023-10-22T12:30:00Z","message":"slow","severity":"WARNING","metadata":{"http":{"method":"GET","status":200,"timing":{"ms":5}},"service":"api"}}`, string(sink.buf))
+
+	log.WithGroup("unused").Error("failed")
+	assert.Equal(t, `{"timestamp":"2023-10-22T12:30:00Z","message":"failed","severity":"ERROR"}`, string(sink.buf))
+
+	sink.buf = nil
+	slog.New(NewSlogHandler(jlog, slog.LevelInfo)).Debug("skipped")
+	assert.Nil(t, sink.buf)
+}
+
+func TestSlogHandlerTrace(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	sink := &testSink{}
+	log := slog.New(NewSlogHandler(NewJSONLoggerWithSink(sink, LevelTrace), nil))
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	log.InfoContext(ctx, "traced", "a", 1)
+	assert.Contains(t, string(sink.buf), `"logging.googleapis.com/trace":"4bf92f3577b34da6a3ce929d0e0e4736","logging.googleapis.com/spanId":"00f067aa0ba902b7"`)
+	assert.Contains(t, string(sink.buf), `"metadata":{"a":1}`)
+
+	log.Info("untraced")
+	assert.NotContains(t, string(sink.buf), "logging.googleapis.com/trace")
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: SlogLevelTrace})))
+	log = log.WithPrefix("[sync]").With(map[string]interface{}{"id": "1"})
+	log.Trace("count %d", 5)
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "count 5", record["msg"])
+	assert.Equal(t, "DEBUG-4", record["level"])
+	assert.Equal(t, "sync", record["component"])
+	assert.Equal(t, "1", record["id"])
+
+	buf.Reset()
+	log.ErrorKV("failed", "attempt", 2)
+	record = nil
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, float64(2), record["attempt"])
+}
+
+func TestSlogLevels(t *testing.T) {
+	for _, level := range []LogLevel{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		assert.Equal(t, level, FromSlogLevel(ToSlogLevel(level)))
+	}
+	assert.Equal(t, LevelInfo, FromSlogLevel(slog.LevelInfo+1))
+}
@@ -6,6 +6,7 @@ type TestLogEntry struct {
 	Severity  string
 	Message   string
 	Arguments []interface{}
+	Fields    map[string]interface{} // the key/value pairs passed to the KV methods
 }
 
 type TestLogger struct {
@@ -39,7 +40,11 @@ func (c *TestLogger) With(metadata map[string]interface{}) Logger {
 }
 
 func (c *TestLogger) Log(level string, msg string, args ...interface{}) {
-	c.Logs = append(c.Logs, TestLogEntry{level, msg, args})
+	c.Logs = append(c.Logs, TestLogEntry{Severity: level, Message: msg, Arguments: args})
+}
+
+func (c *TestLogger) LogKV(level string, msg string, keysAndValues ...interface{}) {
+	c.Logs = append(c.Logs, TestLogEntry{Severity: level, Message: msg, Fields: mergeKV(nil, keysAndValues)})
 }
 
 func (c *TestLogger) Trace(msg string, args ...interface{}) {
@@ -67,6 +72,26 @@ func (c *TestLogger) Fatal(msg string, args ...interface{}) {
 	os.Exit(1)
 }
 
+func (c *TestLogger) TraceKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV("TRACE", msg, keysAndValues...)
+}
+
+func (c *TestLogger) DebugKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV("DEBUG", msg, keysAndValues...)
+}
+
+func (c *TestLogger) InfoKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV("INFO", msg, keysAndValues...)
+}
+
+func (c *TestLogger) WarnKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV("WARNING", msg, keysAndValues...)
+}
+
+func (c *TestLogger) ErrorKV(msg string, keysAndValues ...interface{}) {
+	c.LogKV("ERROR", msg, keysAndValues...)
+}
+
 // NewTestLogger returns a new Logger instance useful for testing
 func NewTestLogger() *TestLogger {
 	return &TestLogger{
@@ -1,5 +1,67 @@
 package logger
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// badKey is the key used for a value without a string key, matching log/slog.
+const badKey = "!BADKEY"
+
 func WithKV(logger Logger, key string, value any) Logger {
 	return logger.With(map[string]interface{}{key: value})
 }
+
+// eachKV calls fn for each of the alternating key/value pairs. A value without a string key uses the key !BADKEY.
+func eachKV(keysAndValues []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(keysAndValues); i++ {
+		key, ok := keysAndValues[i].(string)
+		if !ok || i+1 == len(keysAndValues) {
+			fn(badKey, keysAndValues[i])
+			continue
+		}
+		fn(key, keysAndValues[i+1])
+		i++
+	}
+}
+
+// mergeKV returns the metadata with the key/value pairs added, the metadata isn't modified.
+func mergeKV(metadata map[string]interface{}, keysAndValues []interface{}) map[string]interface{} {
+	if len(keysAndValues) == 0 {
+		return metadata
+	}
+	kv := make(map[string]interface{}, len(metadata)+len(keysAndValues)/2)
+	for k, v := range metadata {
+		kv[k] = v
+	}
+	eachKV(keysAndValues, func(key string, value interface{}) {
+		kv[key] = value
+	})
+	return kv
+}
+
+// formatKV returns the key/value pairs as key=value separated by spaces, quoting values with spaces.
+func formatKV(keysAndValues []interface{}) string {
+	var sb strings.Builder
+	eachKV(keysAndValues, func(key string, value interface{}) {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		var val string
+		if group, ok := value.(map[string]interface{}); ok {
+			buf, _ := json.Marshal(group)
+			val = string(buf)
+		} else {
+			val = fmt.Sprint(value)
+		}
+		if val == "" || strings.ContainsAny(val, " \t\n\"=") {
+			val = strconv.Quote(val)
+		}
+		sb.WriteString(val)
+	})
+	return sb.String()
+}
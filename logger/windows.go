@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package logger
+
+import "os"
+
+func notifyToggle(c chan<- os.Signal) {
+	// windows doesn't have SIGUSR1 so the level can only be changed with the http handler
+}
@@ -1,6 +1,11 @@
 package nats
 
-import "github.com/nats-io/nats.go"
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/propagation"
+)
 
 // Default headers which published in messages from API backend
 const (
@@ -98,3 +103,43 @@ func SetCustomHeader(m *nats.Msg, header string, value string) {
 func setHeader(m *nats.Msg, header string, value string) {
 	m.Header.Set(header, value)
 }
+
+// headerCarrier adapts the message headers so the W3C trace context can be read from and written to them.
+type headerCarrier nats.Header
+
+var _ propagation.TextMapCarrier = headerCarrier(nil)
+
+func (h headerCarrier) Get(key string) string {
+	return nats.Header(h).Get(key)
+}
+
+func (h headerCarrier) Set(key string, value string) {
+	nats.Header(h).Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+var traceContext = propagation.TraceContext{}
+
+// SetTraceHeaders sets the W3C traceparent and tracestate headers from the span in the context so the
+// subscriber's logs are correlated with the publisher's trace.
+func SetTraceHeaders(ctx context.Context, m *nats.Msg) {
+	if m.Header == nil {
+		m.Header = nats.Header{}
+	}
+	traceContext.Inject(ctx, headerCarrier(m.Header))
+}
+
+// ExtractTraceContext returns a copy of the context with the remote span from the W3C trace headers of the message.
+func ExtractTraceContext(ctx context.Context, m *nats.Msg) context.Context {
+	if m.Header == nil {
+		return ctx
+	}
+	return traceContext.Extract(ctx, headerCarrier(m.Header))
+}
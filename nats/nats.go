@@ -255,8 +255,10 @@ func (s *subscriber) run() {
 			s.inflightStarted = &started
 			s.ackLock.Unlock()
 
-			// run our callback handler
-			err = s.handler(s.ctx, data, msg)
+			// run our callback handler with a logger for the message which has the publisher's trace
+			ctx := ExtractTraceContext(s.ctx, msg)
+			ctx = logger.WithContext(ctx, s.logger.With(map[string]interface{}{"msgId": msgid}))
+			err = s.handler(ctx, data, msg)
 
 			// make sure we untrack the inflight state so that the extender knows we're idle
 			s.ackLock.Lock()
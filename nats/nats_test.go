@@ -14,8 +14,28 @@ import (
 	"github.com/shopmonkeyus/go-common/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/vmihailenco/msgpack"
+	"go.opentelemetry.io/otel/trace"
 )
 
+type testSink struct {
+	buf   []byte
+	mutex sync.Mutex
+}
+
+func (s *testSink) Write(buf []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.buf = append([]byte(nil), buf...)
+	return len(buf), nil
+}
+
+// String returns the last log written to the sink.
+func (s *testSink) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return string(s.buf)
+}
+
 func RunTestServer(js bool) *server.Server {
 	opts := natsserver.DefaultTestOptions
 	opts.Port = 8222
@@ -102,6 +122,56 @@ func TestExactlyOnceConsumer(t *testing.T) {
 	server.Shutdown()
 }
 
+func TestExactlyOnceConsumerTraceContext(t *testing.T) {
+	server := RunTestServer(true)
+	defer server.Shutdown()
+	sink := &testSink{}
+	log := logger.NewJSONLoggerWithSink(sink, logger.LevelInfo)
+	n, err := NewNats(log, "test", server.ClientURL(), nil)
+	assert.NoError(t, err, "failed to connect to nats")
+	js, err := n.JetStream()
+	assert.NoError(t, err, "failed to create jetstream")
+	queue := fmt.Sprintf("stream%v", time.Now().UnixNano())
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     queue,
+		Subjects: []string{queue + ".>"},
+	})
+	assert.NoError(t, err, "failed to create stream")
+	received := make(chan trace.SpanContext, 1)
+	handler := func(ctx context.Context, buf []byte, msg *nats.Msg) error {
+		logger.FromContext(ctx).Info("handled")
+		received <- trace.SpanContextFromContext(ctx)
+		msg.AckSync()
+		return nil
+	}
+	sub, err := NewExactlyOnceConsumer(log, js, queue, "test", queue+".*", handler, WithExactlyOnceReplicas(1))
+	assert.NoError(t, err, "failed to create consumer")
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	msg := nats.NewMsg(queue + ".test")
+	msg.Data = []byte("hi")
+	SetTraceHeaders(ctx, msg)
+	_, err = js.PublishMsg(msg)
+	assert.NoError(t, err, "failed to publish")
+	select {
+	case sc := <-received:
+		assert.Equal(t, traceID, sc.TraceID())
+		assert.Equal(t, spanID, sc.SpanID())
+		assert.True(t, sc.IsRemote())
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+	assert.Contains(t, sink.String(), `"logging.googleapis.com/trace":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, sink.String(), `"msgId"`)
+	sub.Close()
+	n.Close()
+}
+
 func TestExactlyOnceConsumerWithMsgPack(t *testing.T) {
 	server := RunTestServer(true)
 	defer server.Shutdown()
@@ -0,0 +1,180 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var ErrRetryBudgetExhausted = fmt.Errorf("retry budget exhausted: %w", ErrTooManyAttempts)
+
+// exponential returns min * 2^attempt capped at max.
+func exponential(min time.Duration, max time.Duration, attempt uint) time.Duration {
+	d := float64(min) * math.Pow(2, float64(attempt))
+	if d > float64(max) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// randomBetween returns a random duration in [min, max).
+func randomBetween(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + rand.N(max-min)
+}
+
+type fullJitterBackoff struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (b *fullJitterBackoff) BackOff(attempt uint) time.Duration {
+	return randomBetween(0, exponential(b.min, b.max, attempt))
+}
+
+// NewFullJitterBackoff creates a new RetryBackoff that retries with a random backoff between 0 and
+// min * 2^attempt (capped at max) which spreads out retries the most.
+func NewFullJitterBackoff(min time.Duration, max time.Duration) RetryBackoff {
+	return &fullJitterBackoff{min, max}
+}
+
+type equalJitterBackoff struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (b *equalJitterBackoff) BackOff(attempt uint) time.Duration {
+	half := exponential(b.min, b.max, attempt) / 2
+	return half + randomBetween(0, half)
+}
+
+// NewEqualJitterBackoff creates a new RetryBackoff that retries with half of min * 2^attempt (capped at max)
+// plus a random amount up to the other half so there is always some backoff.
+func NewEqualJitterBackoff(min time.Duration, max time.Duration) RetryBackoff {
+	return &equalJitterBackoff{min, max}
+}
+
+type decorrelatedJitterBackoff struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (b *decorrelatedJitterBackoff) BackOff(attempt uint) time.Duration {
+	// the backoff is shared by concurrent requests so the previous backoffs are generated instead of stored
+	backoff := b.min
+	for i := uint(0); i < attempt; i++ {
+		backoff = min(b.max, randomBetween(b.min, backoff*3))
+	}
+	return backoff
+}
+
+// NewDecorrelatedJitterBackoff creates a new RetryBackoff that retries with a random backoff between min and
+// 3 times the previous backoff (capped at max).
+func NewDecorrelatedJitterBackoff(min time.Duration, max time.Duration) RetryBackoff {
+	return &decorrelatedJitterBackoff{min, max}
+}
+
+const retryBudgetBuckets = 10
+
+type retryBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// RetryBudget limits the number of retries to a ratio of the requests in a rolling window so a failing
+// downstream doesn't cause a retry storm.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	width      time.Duration
+	mutex      sync.Mutex
+	buckets    [retryBudgetBuckets]retryBucket
+}
+
+// NewRetryBudget returns a new RetryBudget which allows retries up to ratio of the requests (for example 0.1
+// for 10%) plus minRetries in the window.
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	width := window / retryBudgetBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	return &RetryBudget{ratio: ratio, minRetries: minRetries, width: width}
+}
+
+// bucket returns the bucket for now, resetting it if it is from an earlier window.
+func (b *RetryBudget) bucket(now time.Time) *retryBucket {
+	start := now.Truncate(b.width)
+	bucket := &b.buckets[(start.UnixNano()/int64(b.width))%retryBudgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = retryBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *RetryBudget) totals(now time.Time) (int, int) {
+	var requests, retries int
+	cutoff := now.Add(-b.width * retryBudgetBuckets)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(cutoff) {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
+
+// RecordRequest records a new request (not a retry) which adds to the budget.
+func (b *RetryBudget) RecordRequest() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.bucket(time.Now()).requests++
+}
+
+// AllowRetry returns true and records the retry if it is within the budget.
+func (b *RetryBudget) AllowRetry() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	requests, retries := b.totals(now)
+	if float64(retries+1) > float64(b.minRetries)+b.ratio*float64(requests) {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// wait waits for the duration or until the context is done.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithRetryBudget sets the retry budget shared by requests, by default retries are only limited by the max attempts.
+func WithRetryBudget(budget *RetryBudget) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.budget = budget
+	}
+}
+
+// WithMaxRetryAfter sets the max time to wait for a Retry-After header from the server, defaults to 30 seconds.
+// Longer values are capped so a server can't hold a request for hours.
+func WithMaxRetryAfter(max time.Duration) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.maxRetryAfter = max
+	}
+}
@@ -0,0 +1,104 @@
+package request
+
+import (
+	"context"
+	ghttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitterBackoffs(t *testing.T) {
+	min, max := 10*time.Millisecond, 200*time.Millisecond
+	full := NewFullJitterBackoff(min, max)
+	equal := NewEqualJitterBackoff(min, max)
+	decorrelated := NewDecorrelatedJitterBackoff(min, max)
+	for i := 0; i < 100; i++ {
+		for attempt := uint(1); attempt < 10; attempt++ {
+			ceiling := min * time.Duration(1<<attempt)
+			if ceiling > max {
+				ceiling = max
+			}
+			d := full.BackOff(attempt)
+			assert.GreaterOrEqual(t, d, time.Duration(0))
+			assert.Less(t, d, ceiling)
+			d = equal.BackOff(attempt)
+			assert.GreaterOrEqual(t, d, ceiling/2)
+			assert.Less(t, d, ceiling)
+			d = decorrelated.BackOff(attempt)
+			assert.GreaterOrEqual(t, d, min)
+			assert.LessOrEqual(t, d, max)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(0.5, 1, time.Minute)
+	assert.True(t, b.AllowRetry(), "should allow the min retries")
+	assert.False(t, b.AllowRetry())
+	for i := 0; i < 4; i++ {
+		b.RecordRequest()
+	}
+	assert.True(t, b.AllowRetry())
+	assert.True(t, b.AllowRetry())
+	assert.False(t, b.AllowRetry())
+
+	b = NewRetryBudget(0, 1, 50*time.Millisecond)
+	assert.True(t, b.AllowRetry())
+	assert.False(t, b.AllowRetry())
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.AllowRetry(), "old retries should leave the window")
+}
+
+func TestHTTPRetryBudget(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		w.WriteHeader(ghttp.StatusBadGateway)
+	}))
+	defer srv.Close()
+	h := New(WithRetryBudget(NewRetryBudget(0, 1, time.Minute)), WithBackoff(NewFullJitterBackoff(time.Millisecond, time.Millisecond)))
+	resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Equal(t, ghttp.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, uint(2), resp.Attempts, "should stop retrying when the budget is used")
+	assert.Equal(t, 2, count)
+}
+
+func TestHTTPMaxRetryAfter(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		if count < 2 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(ghttp.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	h := New(WithMaxRetryAfter(50 * time.Millisecond))
+	ts := time.Now()
+	resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Less(t, time.Since(ts), time.Second)
+}
+
+func TestHTTPRetryWaitCancelled(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(ghttp.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	h := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ts := time.Now()
+	_, err := h.Deliver(ctx, NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(ts), time.Second, "should stop waiting when the context is done")
+}
@@ -0,0 +1,142 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Result is the result of one request delivered with DeliverAll.
+type Result struct {
+	Request  Request
+	Response *Response
+	Err      error
+}
+
+// defaultBatchConcurrency is the number of requests in a batch which are delivered at the same time by default.
+const defaultBatchConcurrency = 16
+
+type batchOpts struct {
+	failFast    bool
+	maxPerHost  int64
+	concurrency int
+}
+
+type BatchOpt func(opts *batchOpts)
+
+// WithFailFast cancels the requests which haven't finished when a request returns an error, the requests which
+// weren't sent yet fail with context.Canceled. By default every request is delivered and all the errors are returned.
+func WithFailFast() BatchOpt {
+	return func(opts *batchOpts) {
+		opts.failFast = true
+	}
+}
+
+// WithBatchMaxPerHost limits the number of requests in the batch which are sent to the same host at the same time.
+func WithBatchMaxPerHost(max int64) BatchOpt {
+	return func(opts *batchOpts) {
+		opts.maxPerHost = max
+	}
+}
+
+// WithBatchConcurrency sets the number of requests in the batch which are delivered at the same time, defaults to 16.
+func WithBatchConcurrency(concurrency int) BatchOpt {
+	return func(opts *batchOpts) {
+		opts.concurrency = concurrency
+	}
+}
+
+// deliverAll delivers the requests concurrently with deliver and returns the results in the same order.
+func deliverAll(ctx context.Context, deliver func(ctx context.Context, req Request) (*Response, error), reqs []Request, opts []BatchOpt) ([]Result, error) {
+	var config batchOpts
+	for _, opt := range opts {
+		opt(&config)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var hostsMutex sync.Mutex
+	hosts := make(map[string]*semaphore.Weighted)
+	hostLimit := func(req Request) *semaphore.Weighted {
+		if config.maxPerHost <= 0 {
+			return nil
+		}
+		u, err := url.Parse(req.URL())
+		if err != nil {
+			return nil // deliver will return the error
+		}
+		hostsMutex.Lock()
+		defer hostsMutex.Unlock()
+		limit := hosts[u.Host]
+		if limit == nil {
+			limit = semaphore.NewWeighted(config.maxPerHost)
+			hosts[u.Host] = limit
+		}
+		return limit
+	}
+	results := make([]Result, len(reqs))
+	for i, req := range reqs {
+		results[i].Request = req
+	}
+	concurrency := config.concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	slots := semaphore.NewWeighted(int64(concurrency))
+	var errMutex sync.Mutex
+	var firstErr error
+	deliverOne := func(result *Result) {
+		// wait for the host before a slot so requests waiting for a busy host don't hold slots needed by other hosts
+		if limit := hostLimit(result.Request); limit != nil {
+			if err := limit.Acquire(ctx, 1); err != nil {
+				result.Err = err
+				return
+			}
+			defer limit.Release(1)
+		}
+		if err := slots.Acquire(ctx, 1); err != nil {
+			result.Err = err
+			return
+		}
+		defer slots.Release(1)
+		if err := ctx.Err(); err != nil {
+			result.Err = err
+			return
+		}
+		result.Response, result.Err = deliver(ctx, result.Request)
+		if result.Err != nil && config.failFast {
+			errMutex.Lock()
+			if firstErr == nil {
+				firstErr = result.Err
+				cancel()
+			}
+			errMutex.Unlock()
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range results {
+		if err := ctx.Err(); err != nil {
+			// a request failed fast (or the caller cancelled) so the rest aren't sent
+			results[i].Err = err
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliverOne(&results[i])
+		}()
+	}
+	wg.Wait()
+	if config.failFast {
+		return results, firstErr
+	}
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,173 @@
+package request
+
+import (
+	"context"
+	"errors"
+	ghttp "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliverAllOrdered(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	h := New(WithMaxAttempts(1))
+	reqs := []Request{
+		NewHTTPGetRequest(srv.URL+"/slow", nil),
+		NewHTTPGetRequest(srv.URL+"/fast", nil),
+		NewHTTPGetRequest("http://127.0.0.1:1/refused", nil),
+	}
+	results, err := h.DeliverAll(context.Background(), reqs)
+	assert.Error(t, err)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "/slow", string(results[0].Response.Body))
+	assert.Equal(t, "/fast", string(results[1].Response.Body))
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[2].Err)
+	assert.True(t, errors.Is(err, results[2].Err), "should return all the errors")
+	assert.Equal(t, reqs[2], results[2].Request)
+}
+
+func TestDeliverAllFailFast(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	h := New(WithMaxAttempts(1))
+	started := time.Now()
+	results, err := h.DeliverAll(context.Background(), []Request{
+		NewHTTPGetRequest(srv.URL, nil),
+		NewHTTPGetRequest("http://127.0.0.1:1/refused", nil),
+	}, WithFailFast())
+	assert.Error(t, err)
+	assert.Equal(t, results[1].Err, err)
+	assert.ErrorIs(t, results[0].Err, context.Canceled)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestDeliverAllMaxPerHost(t *testing.T) {
+	var inflight, peak int32
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+	}))
+	defer srv.Close()
+	h := New(WithMaxAttempts(1))
+	var reqs []Request
+	for i := 0; i < 10; i++ {
+		reqs = append(reqs, NewHTTPGetRequest(srv.URL, nil))
+	}
+	results, err := h.DeliverAll(context.Background(), reqs, WithBatchMaxPerHost(2))
+	assert.NoError(t, err)
+	assert.Len(t, results, 10)
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+}
+
+func TestDeliverAllConcurrency(t *testing.T) {
+	var inflight, peak int32
+	deliver := func(ctx context.Context, req Request) (*Response, error) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+		return &Response{StatusCode: ghttp.StatusOK}, nil
+	}
+	reqs := make([]Request, 50)
+	for i := range reqs {
+		reqs[i] = NewHTTPGetRequest("http://example.test", nil)
+	}
+	results, err := deliverAll(context.Background(), deliver, reqs, []BatchOpt{WithBatchConcurrency(3)})
+	assert.NoError(t, err)
+	assert.Len(t, results, 50)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&peak))
+
+	atomic.StoreInt32(&peak, 0)
+	_, err = deliverAll(context.Background(), deliver, reqs, nil)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(defaultBatchConcurrency), "should bound the concurrency by default")
+}
+
+func TestDeliverAllTooManyAttempts(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.WriteHeader(ghttp.StatusBadGateway)
+	}))
+	defer srv.Close()
+	h := New(WithMaxAttempts(2), WithBackoff(NewFullJitterBackoff(0, 0)))
+	results, err := h.DeliverAll(context.Background(), []Request{NewHTTPGetRequest(srv.URL, nil)})
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.ErrorIs(t, results[0].Err, ErrTooManyAttempts)
+	assert.Equal(t, ghttp.StatusBadGateway, results[0].Response.StatusCode)
+}
+
+func TestDeliverAllBusyHostDoesntBlockOtherHosts(t *testing.T) {
+	release := make(chan struct{})
+	var fast atomic.Bool
+	deliver := func(ctx context.Context, req Request) (*Response, error) {
+		if req.URL() == "http://slow.test" {
+			<-release
+		} else {
+			fast.Store(true)
+		}
+		return &Response{StatusCode: ghttp.StatusOK}, nil
+	}
+	reqs := []Request{
+		NewHTTPGetRequest("http://slow.test", nil),
+		NewHTTPGetRequest("http://slow.test", nil),
+		NewHTTPGetRequest("http://slow.test", nil),
+		NewHTTPGetRequest("http://fast.test", nil),
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := deliverAll(context.Background(), deliver, reqs, []BatchOpt{WithBatchConcurrency(2), WithBatchMaxPerHost(1)})
+		done <- err
+	}()
+	assert.Eventually(t, fast.Load, time.Second, time.Millisecond, "should deliver to another host while waiting for a busy host")
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestDeliverAllFailFastStopsDispatching(t *testing.T) {
+	var calls atomic.Int32
+	deliver := func(ctx context.Context, req Request) (*Response, error) {
+		calls.Add(1)
+		return nil, errors.New("failed")
+	}
+	reqs := make([]Request, 10)
+	for i := range reqs {
+		reqs[i] = NewHTTPGetRequest("http://example.test", nil)
+	}
+	results, err := deliverAll(context.Background(), deliver, reqs, []BatchOpt{WithBatchConcurrency(1), WithFailFast()})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, int32(1), calls.Load())
+	var cancelled int
+	for _, result := range results {
+		if errors.Is(result.Err, context.Canceled) {
+			cancelled++
+		}
+	}
+	assert.Equal(t, 9, cancelled, "the requests after the failure shouldn't be sent")
+}
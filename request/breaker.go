@@ -0,0 +1,265 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of the circuit for a host.
+type CircuitState int
+
+const (
+	// CircuitClosed sends requests to the host.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests to the host without sending them until the cool down has passed.
+	CircuitOpen
+	// CircuitHalfOpen sends a limited number of probe requests to the host to decide if it has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown state %d", s)
+}
+
+// CircuitOpenError is returned when a request isn't sent because the circuit for the host is open.
+// It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	Host    string
+	RetryAt time.Time // when the circuit will allow a probe request
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s until %s", e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type breakerOpts struct {
+	failureRatio   float64
+	minRequests    int
+	window         time.Duration
+	coolDown       time.Duration
+	halfOpenProbes int
+	idleTimeout    time.Duration
+	onStateChange  func(host string, from CircuitState, to CircuitState)
+}
+
+type BreakerOpt func(opts *breakerOpts)
+
+// WithFailureRatio sets the ratio of failed requests in a window which opens the circuit, defaults to 0.5.
+func WithFailureRatio(ratio float64) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.failureRatio = ratio
+	}
+}
+
+// WithMinRequests sets the number of requests in a window before the failure ratio is checked, defaults to 10.
+func WithMinRequests(min int) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.minRequests = min
+	}
+}
+
+// WithWindow sets how long requests are counted for before the counts are reset, defaults to 1 minute.
+func WithWindow(window time.Duration) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.window = window
+	}
+}
+
+// WithCoolDown sets how long the circuit stays open before probe requests are allowed, defaults to 30 seconds.
+func WithCoolDown(coolDown time.Duration) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.coolDown = coolDown
+	}
+}
+
+// WithHalfOpenProbes sets the number of concurrent probe requests allowed when the circuit is half-open, defaults to 1.
+func WithHalfOpenProbes(probes int) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.halfOpenProbes = probes
+	}
+}
+
+// WithIdleTimeout sets how long the circuit for a host can be closed and unused before it is removed, defaults
+// to 10 minutes. Zero never removes circuits.
+func WithIdleTimeout(timeout time.Duration) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.idleTimeout = timeout
+	}
+}
+
+// WithStateChange sets a function which is called when the circuit for a host changes state.
+func WithStateChange(fn func(host string, from CircuitState, to CircuitState)) BreakerOpt {
+	return func(opts *breakerOpts) {
+		opts.onStateChange = fn
+	}
+}
+
+type circuit struct {
+	state       CircuitState
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probes      int // probe requests in flight when half-open
+	lastUsed    time.Time
+}
+
+// CircuitBreaker tracks the failures of each host and stops sending requests to hosts which are failing.
+type CircuitBreaker struct {
+	opts      breakerOpts
+	mutex     sync.Mutex
+	circuits  map[string]*circuit
+	lastSweep time.Time
+}
+
+// NewCircuitBreaker returns a new CircuitBreaker.
+func NewCircuitBreaker(opts ...BreakerOpt) *CircuitBreaker {
+	config := breakerOpts{
+		failureRatio:   0.5,
+		minRequests:    10,
+		window:         time.Minute,
+		coolDown:       30 * time.Second,
+		halfOpenProbes: 1,
+		idleTimeout:    10 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &CircuitBreaker{opts: config, circuits: make(map[string]*circuit)}
+}
+
+func (b *CircuitBreaker) circuit(host string, now time.Time) *circuit {
+	b.sweep(now)
+	c := b.circuits[host]
+	if c == nil {
+		c = &circuit{windowStart: now}
+		b.circuits[host] = c
+	}
+	c.lastUsed = now
+	return c
+}
+
+// sweep removes the closed circuits which haven't been used for the idle timeout so the circuits for hosts
+// which are no longer called don't build up. It only checks the circuits once per idle timeout.
+func (b *CircuitBreaker) sweep(now time.Time) {
+	if b.opts.idleTimeout <= 0 || now.Sub(b.lastSweep) < b.opts.idleTimeout {
+		return
+	}
+	b.lastSweep = now
+	for host, c := range b.circuits {
+		if c.state == CircuitClosed && now.Sub(c.lastUsed) >= b.opts.idleTimeout {
+			delete(b.circuits, host)
+		}
+	}
+}
+
+func (b *CircuitBreaker) setState(host string, c *circuit, state CircuitState, now time.Time) {
+	from := c.state
+	c.state = state
+	c.requests = 0
+	c.failures = 0
+	c.probes = 0
+	c.windowStart = now
+	if state == CircuitOpen {
+		c.openedAt = now
+	}
+	if b.opts.onStateChange != nil && from != state {
+		b.opts.onStateChange(host, from, state)
+	}
+}
+
+// Allow returns a CircuitOpenError if a request to the host shouldn't be sent. If nil is returned the
+// result of the request must be reported with Record.
+func (b *CircuitBreaker) Allow(host string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	c := b.circuit(host, now)
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.windowStart) > b.opts.window {
+			c.requests, c.failures, c.windowStart = 0, 0, now
+		}
+		return nil
+	case CircuitOpen:
+		if now.Before(c.openedAt.Add(b.opts.coolDown)) {
+			return &CircuitOpenError{Host: host, RetryAt: c.openedAt.Add(b.opts.coolDown)}
+		}
+		b.setState(host, c, CircuitHalfOpen, now)
+	}
+	if c.probes >= b.opts.halfOpenProbes {
+		return &CircuitOpenError{Host: host, RetryAt: now.Add(b.opts.coolDown)}
+	}
+	c.probes++
+	return nil
+}
+
+// Record reports the result of a request to the host which was allowed by Allow.
+func (b *CircuitBreaker) Record(host string, success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	c := b.circuit(host, now)
+	switch c.state {
+	case CircuitClosed:
+		c.requests++
+		if !success {
+			c.failures++
+		}
+		if c.requests >= b.opts.minRequests && float64(c.failures)/float64(c.requests) >= b.opts.failureRatio {
+			b.setState(host, c, CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if success {
+			b.setState(host, c, CircuitClosed, now)
+		} else {
+			b.setState(host, c, CircuitOpen, now)
+		}
+	}
+}
+
+// release is called instead of Record when a request was cancelled before there was a result.
+func (b *CircuitBreaker) release(host string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if c := b.circuits[host]; c != nil && c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// State returns the state of the circuit for the host.
+func (b *CircuitBreaker) State(host string) CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if c := b.circuits[host]; c != nil {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// States returns the state of the circuit for each host which has been used.
+func (b *CircuitBreaker) States() map[string]CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	states := make(map[string]CircuitState, len(b.circuits))
+	for host, c := range b.circuits {
+		states[host] = c.state
+	}
+	return states
+}
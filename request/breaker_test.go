@@ -0,0 +1,115 @@
+package request
+
+import (
+	"context"
+	"errors"
+	ghttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []string
+	b := NewCircuitBreaker(WithMinRequests(4), WithFailureRatio(0.5), WithCoolDown(20*time.Millisecond),
+		WithStateChange(func(host string, from CircuitState, to CircuitState) {
+			changes = append(changes, from.String()+">"+to.String())
+		}))
+	for _, success := range []bool{true, false, true} {
+		assert.NoError(t, b.Allow("example.test"))
+		b.Record("example.test", success)
+	}
+	assert.Equal(t, CircuitClosed, b.State("example.test"))
+	assert.NoError(t, b.Allow("example.test"))
+	b.Record("example.test", false)
+	assert.Equal(t, CircuitOpen, b.State("example.test"))
+
+	err := b.Allow("example.test")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	var openErr *CircuitOpenError
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, "example.test", openErr.Host)
+	assert.NoError(t, b.Allow("other.test"), "other hosts shouldn't be affected")
+
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, b.Allow("example.test"))
+	assert.Equal(t, CircuitHalfOpen, b.State("example.test"))
+	assert.ErrorIs(t, b.Allow("example.test"), ErrCircuitOpen, "should only allow one probe")
+	b.Record("example.test", false)
+	assert.Equal(t, CircuitOpen, b.State("example.test"))
+
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, b.Allow("example.test"))
+	b.Record("example.test", true)
+	assert.Equal(t, CircuitClosed, b.State("example.test"))
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}, changes)
+	assert.Equal(t, map[string]CircuitState{"example.test": CircuitClosed, "other.test": CircuitClosed}, b.States())
+}
+
+func TestCircuitBreakerRemovesIdleCircuits(t *testing.T) {
+	b := NewCircuitBreaker(WithMinRequests(1), WithCoolDown(time.Hour), WithIdleTimeout(20*time.Millisecond))
+	assert.NoError(t, b.Allow("idle"))
+	b.Record("idle", true)
+	assert.NoError(t, b.Allow("open"))
+	b.Record("open", false)
+	assert.Equal(t, CircuitOpen, b.State("open"))
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, b.Allow("active"))
+	assert.Equal(t, map[string]CircuitState{"open": CircuitOpen, "active": CircuitClosed}, b.States(), "should only remove idle closed circuits")
+}
+
+func TestHTTPCircuitBreaker(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(ghttp.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	b := NewCircuitBreaker(WithMinRequests(2), WithCoolDown(time.Minute))
+	h := New(WithCircuitBreaker(b), WithMaxAttempts(1))
+	for i := 0; i < 2; i++ {
+		resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, ghttp.StatusInternalServerError, resp.StatusCode)
+	}
+	assert.Equal(t, CircuitOpen, b.State(u.Host))
+	_, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count), "shouldn't send requests when the circuit is open")
+}
+
+func TestHTTPMaxConcurrencyPerHost(t *testing.T) {
+	var active, peak int32
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	h := New(WithMaxConcurrencyPerHost(2), WithMaxAttempts(1)).(*http)
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	assert.Empty(t, h.hosts, "should remove unused host limits")
+}
@@ -0,0 +1,342 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrInteractionNotFound = errors.New("no recorded interaction matches the request")
+
+// CassetteMode controls if a Cassette replays recorded interactions or records new ones.
+type CassetteMode int
+
+const (
+	// CassetteReplayOrRecord replays matching interactions and sends and records requests which don't match.
+	CassetteReplayOrRecord CassetteMode = iota
+	// CassetteReplay only replays interactions, requests which don't match are sent without being recorded.
+	CassetteReplay
+	// CassetteRecord sends and records every request, replacing the interactions loaded from the file.
+	CassetteRecord
+)
+
+// CassetteRequest is a request as it is stored in a cassette. Masked headers are stored masked.
+type CassetteRequest struct {
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     []byte            `json:"body,omitempty"`
+	BodyHash string            `json:"bodyHash"` // hex encoded sha256 of the body
+}
+
+// Interaction is a recorded request and its response. Error is the error returned with the response, such as
+// ErrTooManyAttempts when the request was retried until the attempts ran out.
+type Interaction struct {
+	Request  CassetteRequest `json:"request"`
+	Response *Response       `json:"response"`
+	Error    string          `json:"error,omitempty"`
+	played   bool
+}
+
+// replayedErrors are the errors returned with a response which are replayed as the same value so errors.Is works.
+var replayedErrors = []error{ErrTooManyAttempts, ErrRetryBudgetExhausted}
+
+// replayError returns the recorded error or nil if the interaction didn't have one.
+func replayError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	for _, err := range replayedErrors {
+		if err.Error() == msg {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Matcher returns true if the request matches the recorded request.
+type Matcher func(req *CassetteRequest, recorded *CassetteRequest) bool
+
+// MatchMethod matches requests with the same method.
+func MatchMethod(req *CassetteRequest, recorded *CassetteRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches requests with the same URL.
+func MatchURL(req *CassetteRequest, recorded *CassetteRequest) bool {
+	return req.URL == recorded.URL
+}
+
+// MatchBody matches requests with the same body hash.
+func MatchBody(req *CassetteRequest, recorded *CassetteRequest) bool {
+	return req.BodyHash == recorded.BodyHash
+}
+
+// MatchHeaders returns a Matcher which matches requests with the same values for the headers (case-insensitive).
+func MatchHeaders(names ...string) Matcher {
+	return func(req *CassetteRequest, recorded *CassetteRequest) bool {
+		for _, name := range names {
+			if headerValue(req.Headers, name) != headerValue(recorded.Headers, name) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+type cassetteOpts struct {
+	mode     CassetteMode
+	matchers []Matcher
+	strict   bool
+	masked   []string
+}
+
+type CassetteOpt func(opts *cassetteOpts)
+
+// WithCassetteMode sets the mode, defaults to CassetteReplayOrRecord.
+func WithCassetteMode(mode CassetteMode) CassetteOpt {
+	return func(opts *cassetteOpts) {
+		opts.mode = mode
+	}
+}
+
+// WithMatchers sets the matchers which must all match for an interaction to be replayed, defaults to
+// MatchMethod and MatchURL.
+func WithMatchers(matchers ...Matcher) CassetteOpt {
+	return func(opts *cassetteOpts) {
+		opts.matchers = matchers
+	}
+}
+
+// WithStrict returns ErrInteractionNotFound for requests which don't match a recorded interaction instead of
+// sending them. It has no effect in CassetteRecord mode.
+func WithStrict() CassetteOpt {
+	return func(opts *cassetteOpts) {
+		opts.strict = true
+	}
+}
+
+// WithCassetteMaskHeaders sets the headers which are masked before being saved, defaults to DefaultMaskHeaders.
+func WithCassetteMaskHeaders(headers ...string) CassetteOpt {
+	return func(opts *cassetteOpts) {
+		opts.masked = headers
+	}
+}
+
+// Cassette is an Http which replays interactions recorded to a file so tests don't need a live server.
+// Each matching interaction is replayed once in the order it was recorded, after which the last match
+// is replayed again.
+type Cassette struct {
+	filename     string
+	next         Http
+	opts         cassetteOpts
+	mutex        sync.Mutex
+	interactions []*Interaction
+	dirty        bool
+}
+
+var _ Http = (*Cassette)(nil)
+
+// NewCassette returns a new Cassette which loads the interactions from filename if it exists. Requests which
+// need to be sent are delivered with next, which may be nil when only replaying in strict mode.
+func NewCassette(filename string, next Http, opts ...CassetteOpt) (*Cassette, error) {
+	config := cassetteOpts{
+		matchers: []Matcher{MatchMethod, MatchURL},
+		masked:   DefaultMaskHeaders,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	c := &Cassette{filename: filename, next: next, opts: config}
+	if config.mode == CassetteRecord {
+		return c, nil
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("error reading cassette: %w", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("error parsing cassette %s: %w", filename, err)
+	}
+	c.interactions = file.Interactions
+	return c, nil
+}
+
+// toCassetteRequest returns the request as it would be stored.
+func (c *Cassette) toCassetteRequest(req Request) (*CassetteRequest, error) {
+	body := req.Payload()
+	if sreq, ok := req.(StreamingRequest); ok {
+		rc, err := sreq.Body()
+		if err != nil {
+			return nil, fmt.Errorf("error reading body: %w", err)
+		}
+		defer rc.Close()
+		if body, err = io.ReadAll(rc); err != nil {
+			return nil, fmt.Errorf("error reading body: %w", err)
+		}
+	}
+	var headers map[string]string
+	if len(req.Headers()) > 0 {
+		headers = maskHeaderMap(req.Headers(), c.opts.masked)
+	}
+	sum := sha256.Sum256(body)
+	return &CassetteRequest{
+		Method:   req.Method(),
+		URL:      req.URL(),
+		Headers:  headers,
+		Body:     body,
+		BodyHash: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+func (c *Cassette) matches(req *CassetteRequest, recorded *CassetteRequest) bool {
+	for _, matcher := range c.opts.matchers {
+		if !matcher(req, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the first matching interaction which hasn't been played or the last match if they all have.
+func (c *Cassette) find(req *CassetteRequest) *Interaction {
+	var last *Interaction
+	for _, interaction := range c.interactions {
+		if !c.matches(req, &interaction.Request) {
+			continue
+		}
+		if !interaction.played {
+			return interaction
+		}
+		last = interaction
+	}
+	return last
+}
+
+// replay returns a copy of the recorded response so the caller can't modify the cassette.
+func replay(resp *Response, stream bool) *Response {
+	r := *resp
+	r.Headers = make(map[string]string, len(resp.Headers))
+	for k, v := range resp.Headers {
+		r.Headers[k] = v
+	}
+	if stream {
+		r.Stream = io.NopCloser(bytes.NewReader(resp.Body))
+		r.Body = nil
+	} else {
+		r.Body = append([]byte(nil), resp.Body...)
+	}
+	return &r
+}
+
+func (c *Cassette) Deliver(ctx context.Context, req Request) (*Response, error) {
+	return c.deliver(ctx, req, false)
+}
+
+func (c *Cassette) DeliverStream(ctx context.Context, req Request) (*Response, error) {
+	return c.deliver(ctx, req, true)
+}
+
+func (c *Cassette) DeliverAll(ctx context.Context, reqs []Request, opts ...BatchOpt) ([]Result, error) {
+	return deliverAll(ctx, c.Deliver, reqs, opts)
+}
+
+func (c *Cassette) deliver(ctx context.Context, req Request, stream bool) (*Response, error) {
+	creq, err := c.toCassetteRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.mode != CassetteRecord {
+		c.mutex.Lock()
+		interaction := c.find(creq)
+		if interaction != nil {
+			interaction.played = true
+		}
+		c.mutex.Unlock()
+		if interaction != nil {
+			return replay(interaction.Response, stream), replayError(interaction.Error)
+		}
+		if c.opts.strict {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, creq.Method, creq.URL)
+		}
+	}
+	if c.next == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, creq.Method, creq.URL)
+	}
+	// always read the whole body so it can be recorded
+	resp, err := c.next.Deliver(ctx, req)
+	if resp == nil || c.opts.mode == CassetteReplay {
+		if resp != nil && stream {
+			resp = replay(resp, true)
+		}
+		return resp, err
+	}
+	// a response returned with an error (such as the last response with ErrTooManyAttempts) is recorded with it
+	interaction := &Interaction{Request: *creq, played: true}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	recorded := *resp
+	recorded.Headers = maskHeaderMap(resp.Headers, c.opts.masked)
+	recorded.Timings = nil
+	interaction.Response = &recorded
+	c.mutex.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.dirty = true
+	c.mutex.Unlock()
+	return replay(resp, stream), err
+}
+
+// Interactions returns the recorded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	interactions := make([]Interaction, len(c.interactions))
+	for i, interaction := range c.interactions {
+		interactions[i] = *interaction
+	}
+	return interactions
+}
+
+// Save writes the interactions to the file if any were recorded.
+func (c *Cassette) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	buf, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+	if err := os.WriteFile(c.filename, buf, 0644); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,113 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	ghttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=abcdef")
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	filename := filepath.Join(t.TempDir(), "cassette.json")
+	headers := map[string]string{"Authorization": "Bearer secrettoken", "X-Tenant": "1", "Idempotency-Key": "test"}
+
+	cassette, err := NewCassette(filename, New(WithMaxAttempts(1)), WithMatchers(MatchMethod, MatchURL, MatchBody, MatchHeaders("x-tenant")))
+	assert.NoError(t, err)
+	resp, err := cassette.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, headers, []byte("a")))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo:a", string(resp.Body))
+	resp, err = cassette.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, headers, []byte("b")))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo:b", string(resp.Body))
+	assert.NoError(t, cassette.Save())
+	assert.Equal(t, 2, count)
+	srv.Close()
+
+	buf, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(buf), "secrettoken")
+	assert.NotContains(t, string(buf), "abcdef")
+
+	replayer, err := NewCassette(filename, nil, WithCassetteMode(CassetteReplay), WithStrict(), WithMatchers(MatchMethod, MatchURL, MatchBody, MatchHeaders("x-tenant")))
+	assert.NoError(t, err)
+	assert.Len(t, replayer.Interactions(), 2)
+	resp, err = replayer.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, headers, []byte("b")))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo:b", string(resp.Body))
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+
+	resp, err = replayer.DeliverStream(context.Background(), NewHTTPPostRequest(srv.URL, headers, []byte("a")))
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Stream)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Stream.Close())
+	assert.Equal(t, "echo:a", string(body))
+
+	_, err = replayer.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, headers, []byte("c")))
+	assert.True(t, errors.Is(err, ErrInteractionNotFound))
+	_, err = replayer.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, map[string]string{"X-Tenant": "2"}, []byte("a")))
+	assert.True(t, errors.Is(err, ErrInteractionNotFound), "should match the selected headers")
+	assert.Equal(t, 2, count, "shouldn't send requests when replaying")
+}
+
+func TestCassetteReplaysInOrder(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		w.Write([]byte{byte('0' + count)})
+	}))
+	defer srv.Close()
+	filename := filepath.Join(t.TempDir(), "cassette.json")
+	cassette, err := NewCassette(filename, New(WithMaxAttempts(1)), WithCassetteMode(CassetteRecord))
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err := cassette.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, cassette.Save())
+
+	replayer, err := NewCassette(filename, New(WithMaxAttempts(1)))
+	assert.NoError(t, err)
+	for _, expected := range []string{"1", "2", "2"} {
+		resp, err := replayer.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(resp.Body))
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestCassetteReplaysErrorWithResponse(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		w.WriteHeader(ghttp.StatusBadGateway)
+	}))
+	defer srv.Close()
+	filename := filepath.Join(t.TempDir(), "cassette.json")
+	cassette, err := NewCassette(filename, New(WithMaxAttempts(2), WithBackoff(NewFullJitterBackoff(0, 0))), WithCassetteMode(CassetteRecord))
+	assert.NoError(t, err)
+	resp, err := cassette.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Equal(t, ghttp.StatusBadGateway, resp.StatusCode)
+	assert.NoError(t, cassette.Save())
+
+	replayer, err := NewCassette(filename, nil, WithStrict())
+	assert.NoError(t, err)
+	resp, err = replayer.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Equal(t, ghttp.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,221 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	ghttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature timestamp outside of tolerance")
+	ErrRequestTooLarge  = errors.New("request body too large")
+)
+
+const (
+	// DefaultSignatureHeader is the header the HMAC signature is sent in by default.
+	DefaultSignatureHeader = "X-Signature"
+	// DefaultMaxVerifyBodySize is the largest body read by VerifyRequest when maxBodySize isn't set.
+	DefaultMaxVerifyBodySize = 10 * 1024 * 1024
+)
+
+// Interceptor can modify each attempt of a request before it is sent and inspect the response.
+type Interceptor interface {
+	// BeforeSend is called before each attempt is sent. Returning an error fails the request without sending it.
+	BeforeSend(ctx context.Context, req *ghttp.Request) error
+	// AfterResponse is called after each attempt with the response or the error. The response body
+	// shouldn't be read.
+	AfterResponse(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error)
+}
+
+// InterceptorFuncs is an Interceptor made from functions, either of which may be nil.
+type InterceptorFuncs struct {
+	Before func(ctx context.Context, req *ghttp.Request) error
+	After  func(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error)
+}
+
+var _ Interceptor = (*InterceptorFuncs)(nil)
+
+func (f *InterceptorFuncs) BeforeSend(ctx context.Context, req *ghttp.Request) error {
+	if f.Before == nil {
+		return nil
+	}
+	return f.Before(ctx, req)
+}
+
+func (f *InterceptorFuncs) AfterResponse(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error) {
+	if f.After != nil {
+		f.After(ctx, req, resp, err)
+	}
+}
+
+type hmacSigner struct {
+	secret []byte
+	header string
+}
+
+var _ Interceptor = (*hmacSigner)(nil)
+
+// sign returns the hex encoded HMAC-SHA256 of the timestamp and body.
+func sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *hmacSigner) BeforeSend(ctx context.Context, req *ghttp.Request) error {
+	var body []byte
+	if req.GetBody != nil {
+		// read a copy of the body so the body being sent isn't consumed
+		rc, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("error reading body to sign: %w", err)
+		}
+		defer rc.Close()
+		if body, err = io.ReadAll(rc); err != nil {
+			return fmt.Errorf("error reading body to sign: %w", err)
+		}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(s.header, fmt.Sprintf("t=%s,v1=%s", timestamp, sign(s.secret, timestamp, body)))
+	return nil
+}
+
+func (s *hmacSigner) AfterResponse(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error) {
+}
+
+type signerOpts struct {
+	header string
+}
+
+type SignerOpt func(opts *signerOpts)
+
+// WithSignatureHeader sets the header the signature is sent in, defaults to DefaultSignatureHeader.
+func WithSignatureHeader(header string) SignerOpt {
+	return func(opts *signerOpts) {
+		opts.header = header
+	}
+}
+
+// NewHMACSigner returns an Interceptor which signs each attempt with a header in the form t=<unix timestamp>,v1=<signature>
+// where the signature is the hex encoded HMAC-SHA256 of the timestamp, a period and the body. Streaming request bodies are
+// read an extra time to sign them.
+func NewHMACSigner(secret []byte, opts ...SignerOpt) Interceptor {
+	config := signerOpts{header: DefaultSignatureHeader}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &hmacSigner{secret: secret, header: config.header}
+}
+
+// VerifySignature verifies a signature header created by NewHMACSigner for the body. The signature must match one of the
+// secrets (so secrets can be rotated) and the timestamp must be within tolerance of now (or zero to skip the check).
+func VerifySignature(header string, body []byte, tolerance time.Duration, secrets ...[]byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if tolerance > 0 {
+		if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+			return ErrSignatureExpired
+		}
+	}
+	for _, secret := range secrets {
+		expected := sign(secret, timestamp, body)
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(expected), []byte(signature)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// VerifyRequest verifies the signature of a request received from a client using NewHMACSigner and returns the body.
+// The request body is replaced so it can be read again. Bodies larger than maxBodySize bytes (DefaultMaxVerifyBodySize
+// if maxBodySize is 0 or less) aren't read and return ErrRequestTooLarge.
+func VerifyRequest(req *ghttp.Request, header string, tolerance time.Duration, maxBodySize int64, secrets ...[]byte) ([]byte, error) {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxVerifyBodySize
+	}
+	var body []byte
+	if req.Body != nil {
+		if req.ContentLength > maxBodySize {
+			req.Body.Close()
+			return nil, ErrRequestTooLarge
+		}
+		b, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading body: %w", err)
+		}
+		if int64(len(b)) > maxBodySize {
+			return nil, ErrRequestTooLarge
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err := VerifySignature(req.Header.Get(header), body, tolerance, secrets...); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+type bearerToken struct {
+	source oauth2.TokenSource
+}
+
+var _ Interceptor = (*bearerToken)(nil)
+
+func (b *bearerToken) BeforeSend(ctx context.Context, req *ghttp.Request) error {
+	token, err := b.source.Token()
+	if err != nil {
+		return fmt.Errorf("error getting token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+func (b *bearerToken) AfterResponse(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error) {
+}
+
+// NewBearerToken returns an Interceptor which sets the Authorization header with a token from the source. The token is
+// reused until it expires and then refreshed from the source.
+func NewBearerToken(source oauth2.TokenSource) Interceptor {
+	return &bearerToken{source: oauth2.ReuseTokenSource(nil, source)}
+}
+
+// WithInterceptors adds interceptors which are called for each attempt. BeforeSend is called in the order the
+// interceptors are added and AfterResponse in the reverse order.
+func WithInterceptors(interceptors ...Interceptor) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.interceptors = append(opts.interceptors, interceptors...)
+	}
+}
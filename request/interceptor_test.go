@@ -0,0 +1,146 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	ghttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestHTTPInterceptors(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		assert.Equal(t, "value", r.Header.Get("X-Custom"))
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	var calls []string
+	first := &InterceptorFuncs{
+		Before: func(ctx context.Context, req *ghttp.Request) error {
+			calls = append(calls, "before1")
+			req.Header.Set("X-Custom", "value")
+			return nil
+		},
+		After: func(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error) {
+			calls = append(calls, "after1:"+strconv.Itoa(resp.StatusCode))
+		},
+	}
+	second := &InterceptorFuncs{
+		Before: func(ctx context.Context, req *ghttp.Request) error {
+			calls = append(calls, "before2")
+			return nil
+		},
+		After: func(ctx context.Context, req *ghttp.Request, resp *ghttp.Response, err error) {
+			calls = append(calls, "after2")
+		},
+	}
+	h := New(WithInterceptors(first, second), WithMaxAttempts(1))
+	resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"before1", "before2", "after2", "after1:200"}, calls)
+
+	failing := &InterceptorFuncs{Before: func(ctx context.Context, req *ghttp.Request) error {
+		return errors.New("not allowed")
+	}}
+	_, err = New(WithInterceptors(failing), WithMaxAttempts(1)).Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.EqualError(t, err, "not allowed")
+}
+
+func TestHTTPHMACSigner(t *testing.T) {
+	secret := []byte("shh")
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		body, err := VerifyRequest(r, DefaultSignatureHeader, time.Minute, 100, []byte("old"), secret)
+		if errors.Is(err, ErrRequestTooLarge) {
+			w.WriteHeader(ghttp.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(ghttp.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, `{"hello":"world"}`, string(body))
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	h := New(WithInterceptors(NewHMACSigner(secret)), WithMaxAttempts(1))
+	resp, err := h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, nil, []byte(`{"hello":"world"}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+
+	h = New(WithInterceptors(NewHMACSigner([]byte("wrong"))), WithMaxAttempts(1))
+	resp, err = h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, nil, []byte(`{"hello":"world"}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusUnauthorized, resp.StatusCode)
+
+	h = New(WithInterceptors(NewHMACSigner(secret)), WithMaxAttempts(1))
+	resp, err = h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, nil, bytes.Repeat([]byte("x"), 101)))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestVerifyRequestMaxBodySize(t *testing.T) {
+	secret := []byte("shh")
+	body := bytes.Repeat([]byte("x"), 101)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	// the reader hides the length so the body is read without a content length
+	req := httptest.NewRequest(ghttp.MethodPost, "/", io.MultiReader(bytes.NewReader(body)))
+	req.Header.Set(DefaultSignatureHeader, fmt.Sprintf("t=%s,v1=%s", ts, sign(secret, ts, body)))
+	_, err := VerifyRequest(req, DefaultSignatureHeader, time.Minute, 100, secret)
+	assert.ErrorIs(t, err, ErrRequestTooLarge)
+
+	req = httptest.NewRequest(ghttp.MethodPost, "/", io.MultiReader(bytes.NewReader(body)))
+	req.Header.Set(DefaultSignatureHeader, fmt.Sprintf("t=%s,v1=%s", ts, sign(secret, ts, body)))
+	verified, err := VerifyRequest(req, DefaultSignatureHeader, time.Minute, 101, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, body, verified)
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("shh")
+	body := []byte("payload")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	header := fmt.Sprintf("t=%s,v1=%s", ts, sign(secret, ts, body))
+	assert.NoError(t, VerifySignature(header, body, time.Minute, secret))
+	assert.ErrorIs(t, VerifySignature(header, []byte("tampered"), time.Minute, secret), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature(header, body, time.Minute, []byte("other")), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("garbage", body, time.Minute, secret), ErrInvalidSignature)
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	header = fmt.Sprintf("t=%s,v1=%s", old, sign(secret, old, body))
+	assert.ErrorIs(t, VerifySignature(header, body, time.Minute, secret), ErrSignatureExpired)
+	assert.NoError(t, VerifySignature(header, body, 0, secret), "should skip the timestamp check without a tolerance")
+}
+
+type testTokenSource struct {
+	count int
+}
+
+func (s *testTokenSource) Token() (*oauth2.Token, error) {
+	s.count++
+	return &oauth2.Token{AccessToken: "token" + strconv.Itoa(s.count), TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestHTTPBearerToken(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		assert.Equal(t, "Bearer token1", r.Header.Get("Authorization"))
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	var source testTokenSource
+	h := New(WithInterceptors(NewBearerToken(&source)), WithMaxAttempts(1))
+	for i := 0; i < 2; i++ {
+		resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, 1, source.count, "should reuse the token until it expires")
+}
@@ -0,0 +1,366 @@
+package request
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	ghttp "net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	cstr "github.com/shopmonkeyus/go-common/string"
+)
+
+// DefaultMaskHeaders are the headers masked by the recorders by default.
+var DefaultMaskHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", DefaultSignatureHeader}
+
+// maskedHeaderValue replaces the whole value of a masked header so no part of a secret is recorded.
+const maskedHeaderValue = "REDACTED"
+
+const defaultRecorderBodyLimit = 64 * 1024
+
+type recorderOpts struct {
+	masked    []string
+	bodyLimit int
+}
+
+type RecorderOpt func(opts *recorderOpts)
+
+// WithMaskHeaders sets the headers whose values are replaced with REDACTED, defaults to DefaultMaskHeaders.
+func WithMaskHeaders(headers ...string) RecorderOpt {
+	return func(opts *recorderOpts) {
+		opts.masked = headers
+	}
+}
+
+// WithBodyLimit sets the max number of bytes of each body which is recorded, defaults to 64KB. Use -1 to skip bodies.
+func WithBodyLimit(limit int) RecorderOpt {
+	return func(opts *recorderOpts) {
+		opts.bodyLimit = limit
+	}
+}
+
+func newRecorderOpts(opts []RecorderOpt) recorderOpts {
+	config := recorderOpts{masked: DefaultMaskHeaders, bodyLimit: defaultRecorderBodyLimit}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// maskHeaders returns the headers with the sensitive headers masked.
+func (o *recorderOpts) maskHeaders(headers map[string]string) map[string]string {
+	return maskHeaderMap(headers, o.masked)
+}
+
+func maskHeaderMap(headers map[string]string, masked []string) map[string]string {
+	h := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if cstr.Contains(masked, k, true) {
+			v = maskedHeaderValue
+		}
+		h[k] = v
+	}
+	return h
+}
+
+// body returns the body as text (base64 encoded if it isn't valid utf-8) truncated to the limit.
+func (o *recorderOpts) body(b []byte) (text string, encoding string, truncated bool) {
+	if o.bodyLimit < 0 || len(b) == 0 {
+		return "", "", false
+	}
+	if len(b) > o.bodyLimit {
+		b = b[:o.bodyLimit]
+		truncated = true
+	}
+	if !utf8.Valid(b) {
+		return base64.StdEncoding.EncodeToString(b), "base64", truncated
+	}
+	return string(b), "", truncated
+}
+
+// elapsed returns the duration of the attempt.
+func elapsed(resp *Response) time.Duration {
+	if resp.Timings == nil {
+		return resp.Latency
+	}
+	return resp.Timings.DNS + resp.Timings.Connect + resp.Timings.TLS + resp.Timings.TTFB
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+func toNameValues(headers map[string]string) []harNameValue {
+	values := make([]harNameValue, 0, len(headers))
+	for k, v := range headers {
+		values = append(values, harNameValue{k, v})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// HARRecorder is a Recorder which collects the requests and responses in the HAR 1.2 format.
+type HARRecorder struct {
+	opts    recorderOpts
+	mutex   sync.Mutex
+	entries []harEntry
+}
+
+var _ Recorder = (*HARRecorder)(nil)
+
+// NewHARRecorder returns a new HARRecorder.
+func NewHARRecorder(opts ...RecorderOpt) *HARRecorder {
+	return &HARRecorder{opts: newRecorderOpts(opts)}
+}
+
+func (r *HARRecorder) OnResponse(ctx context.Context, req Request, resp *Response) {
+	duration := elapsed(resp)
+	entry := harEntry{
+		StartedDateTime: time.Now().Add(-duration).Format(time.RFC3339Nano),
+		Time:            milliseconds(duration),
+		Request: harRequest{
+			Method:      req.Method(),
+			URL:         req.URL(),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     toNameValues(r.opts.maskHeaders(req.Headers())),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(req.Payload()),
+		},
+		Response: harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  ghttp.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     toNameValues(r.opts.maskHeaders(resp.Headers)),
+			Content:     harContent{Size: len(resp.Body), MimeType: resp.Headers["Content-Type"]},
+			HeadersSize: -1,
+			BodySize:    len(resp.Body),
+		},
+		Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: milliseconds(duration)},
+	}
+	if resp.Proto != "" {
+		entry.Request.HTTPVersion = resp.Proto
+	}
+	if u, err := url.Parse(req.URL()); err == nil {
+		for k, values := range u.Query() {
+			for _, v := range values {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{k, v})
+			}
+		}
+	}
+	if text, _, truncated := r.opts.body(req.Payload()); text != "" {
+		// the post data doesn't support an encoding so binary bodies are base64 encoded text
+		entry.Request.PostData = &harPostData{MimeType: req.Headers()["Content-Type"], Text: text}
+		if truncated {
+			entry.Request.PostData.Comment = "truncated"
+		}
+	}
+	text, encoding, truncated := r.opts.body(resp.Body)
+	entry.Response.Content.Text = text
+	entry.Response.Content.Encoding = encoding
+	if truncated {
+		entry.Response.Content.Comment = "truncated"
+	}
+	if t := resp.Timings; t != nil && !t.ReusedConn {
+		entry.Timings.DNS = milliseconds(t.DNS)
+		entry.Timings.Connect = milliseconds(t.Connect + t.TLS) // the connect time includes the ssl time in HAR
+		entry.Timings.SSL = milliseconds(t.TLS)
+	}
+	if t := resp.Timings; t != nil {
+		entry.Timings.Wait = milliseconds(t.TTFB)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// WriteTo writes the recorded entries as a HAR file.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	file := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "go-common", Version: "1.0"},
+		Entries: append([]harEntry{}, r.entries...),
+	}}
+	r.mutex.Unlock()
+	buf, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("error encoding har: %w", err)
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// WriteFile writes the recorded entries to a HAR file.
+func (r *HARRecorder) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating har file: %w", err)
+	}
+	if _, err := r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type auditRecord struct {
+	Time                  time.Time         `json:"time"`
+	RequestID             string            `json:"requestId,omitempty"`
+	Attempt               uint              `json:"attempt"`
+	Method                string            `json:"method"`
+	URL                   string            `json:"url"`
+	RequestHeaders        map[string]string `json:"requestHeaders"`
+	RequestBody           string            `json:"requestBody,omitempty"`
+	RequestBodyEncoding   string            `json:"requestBodyEncoding,omitempty"`
+	RequestBodyTruncated  bool              `json:"requestBodyTruncated,omitempty"`
+	StatusCode            int               `json:"statusCode"`
+	ResponseHeaders       map[string]string `json:"responseHeaders"`
+	ResponseBody          string            `json:"responseBody,omitempty"`
+	ResponseBodyEncoding  string            `json:"responseBodyEncoding,omitempty"`
+	ResponseBodyTruncated bool              `json:"responseBodyTruncated,omitempty"`
+	Latency               time.Duration     `json:"latency"`
+}
+
+// NDJSONRecorder is a Recorder which writes each request and response as a line of JSON for an audit log.
+type NDJSONRecorder struct {
+	opts  recorderOpts
+	mutex sync.Mutex
+	w     io.Writer
+	err   error
+}
+
+var _ Recorder = (*NDJSONRecorder)(nil)
+
+// NewNDJSONRecorder returns a new NDJSONRecorder which writes to w.
+func NewNDJSONRecorder(w io.Writer, opts ...RecorderOpt) *NDJSONRecorder {
+	return &NDJSONRecorder{opts: newRecorderOpts(opts), w: w}
+}
+
+func (r *NDJSONRecorder) OnResponse(ctx context.Context, req Request, resp *Response) {
+	headers := req.Headers()
+	record := auditRecord{
+		Time:            time.Now().UTC(),
+		RequestID:       headers["X-Request-Id"],
+		Attempt:         resp.Attempts,
+		Method:          req.Method(),
+		URL:             req.URL(),
+		RequestHeaders:  r.opts.maskHeaders(headers),
+		StatusCode:      resp.StatusCode,
+		ResponseHeaders: r.opts.maskHeaders(resp.Headers),
+		Latency:         resp.Latency,
+	}
+	record.RequestBody, record.RequestBodyEncoding, record.RequestBodyTruncated = r.opts.body(req.Payload())
+	record.ResponseBody, record.ResponseBodyEncoding, record.ResponseBodyTruncated = r.opts.body(resp.Body)
+	buf, err := json.Marshal(record)
+	if err != nil {
+		r.setErr(fmt.Errorf("error encoding record: %w", err))
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, err := r.w.Write(append(buf, '\n')); err != nil && r.err == nil {
+		r.err = fmt.Errorf("error writing record: %w", err)
+	}
+}
+
+func (r *NDJSONRecorder) setErr(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Err returns the first error encoding or writing a record since the Recorder interface can't return one.
+func (r *NDJSONRecorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
@@ -0,0 +1,108 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	ghttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPRecorderSeesSentRequest(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	var tr testRecord
+	headers := map[string]string{"Content-Type": "application/json"}
+	h := New(WithRecorder(&tr), WithInterceptors(NewHMACSigner([]byte("secret"))), WithMaxAttempts(1))
+	_, err := h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, headers, []byte(`{}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, headers, "shouldn't modify the caller's headers")
+	sent := tr.req.Headers()
+	assert.Equal(t, "application/json", sent["Content-Type"])
+	assert.Equal(t, userAgentHeaderValue, sent["User-Agent"])
+	assert.Equal(t, "1", sent["X-Attempt"])
+	assert.NotEmpty(t, sent["X-Request-Id"])
+	assert.NotEmpty(t, sent[DefaultSignatureHeader])
+	assert.Equal(t, []byte(`{}`), tr.req.Payload())
+}
+
+func TestHARRecorder(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=abcdef")
+		w.WriteHeader(ghttp.StatusCreated)
+		w.Write([]byte(strings.Repeat("a", 20)))
+	}))
+	defer srv.Close()
+	recorder := NewHARRecorder(WithBodyLimit(10))
+	h := New(WithRecorder(recorder), WithMaxAttempts(1))
+	_, err := h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL+"?a=b", map[string]string{"Authorization": "Bearer secrettoken"}, []byte(`{"a":1}`)))
+	assert.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "test.har")
+	assert.NoError(t, recorder.WriteFile(filename))
+	buf, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	var har harFile
+	assert.NoError(t, json.Unmarshal(buf, &har))
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Len(t, har.Log.Entries, 1)
+	entry := har.Log.Entries[0]
+	assert.Equal(t, ghttp.MethodPost, entry.Request.Method)
+	assert.Equal(t, []harNameValue{{"a", "b"}}, entry.Request.QueryString)
+	assert.Equal(t, `{"a":1}`, entry.Request.PostData.Text)
+	for _, header := range entry.Request.Headers {
+		if header.Name == "Authorization" {
+			assert.Equal(t, "REDACTED", header.Value)
+		}
+	}
+	for _, part := range []string{"Bearer", "secret", "token", "abcdef"} {
+		assert.NotContains(t, string(buf), part, "no part of a masked header should be recorded")
+	}
+	assert.Equal(t, ghttp.StatusCreated, entry.Response.Status)
+	assert.Equal(t, "HTTP/1.1", entry.Response.HTTPVersion)
+	assert.Equal(t, 20, entry.Response.Content.Size)
+	assert.Equal(t, strings.Repeat("a", 10), entry.Response.Content.Text)
+	assert.Equal(t, "truncated", entry.Response.Content.Comment)
+	assert.GreaterOrEqual(t, entry.Time, 0.0)
+}
+
+func TestNDJSONRecorder(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		if count == 1 {
+			w.WriteHeader(ghttp.StatusBadGateway)
+			return
+		}
+		w.Write([]byte{0xff, 0xfe})
+	}))
+	defer srv.Close()
+	var buf bytes.Buffer
+	recorder := NewNDJSONRecorder(&buf)
+	h := New(WithRecorder(recorder), WithBackoff(NewFullJitterBackoff(0, 0)))
+	_, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, map[string]string{"X-Api-Key": "supersecret"}))
+	assert.NoError(t, err)
+	assert.NoError(t, recorder.Err())
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2, "should record each attempt")
+	var first, second auditRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, uint(1), first.Attempt)
+	assert.Equal(t, ghttp.StatusBadGateway, first.StatusCode)
+	assert.Equal(t, uint(2), second.Attempt)
+	assert.Equal(t, "2", second.RequestHeaders["X-Attempt"])
+	assert.NotEqual(t, first.RequestID, second.RequestID)
+	assert.NotContains(t, second.RequestHeaders["X-Api-Key"], "supersecret")
+	assert.Equal(t, "//4=", second.ResponseBody)
+	assert.Equal(t, "base64", second.ResponseBodyEncoding)
+}
@@ -7,11 +7,12 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"net"
 	ghttp "net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -79,14 +80,19 @@ func NewHTTPPostRequest(url string, headers map[string]string, payload []byte) R
 // Response is the response from an HTTP request.
 type Response struct {
 	StatusCode int               `json:"statusCode"`
+	Proto      string            `json:"proto,omitempty"`
 	Body       []byte            `json:"body,omitempty"`
 	Headers    map[string]string `json:"headers"`
 	Attempts   uint              `json:"attempts"`
 	Latency    time.Duration     `json:"latency"`
+	Timings    *Timings          `json:"timings,omitempty"`
+	Stream     io.ReadCloser     `json:"-"` // the open body for DeliverStream which must be closed by the caller
 }
 
 // Recorder is an interface for recording request / responses.
 type Recorder interface {
+	// OnResponse is called with the request as it was sent (including the headers added for the attempt) and the
+	// response for each attempt.
 	OnResponse(ctx context.Context, req Request, resp *Response)
 }
 
@@ -94,6 +100,15 @@ type Recorder interface {
 type Http interface {
 	// Deliver sends a request and returns a response.
 	Deliver(ctx context.Context, request Request) (*Response, error)
+	// DeliverStream sends a request and returns a response with the body in Stream instead of Body. The caller
+	// must close the stream. The timeout only applies until the response headers are received, the body can be
+	// read until ctx is done and closing the stream cancels the request.
+	DeliverStream(ctx context.Context, request Request) (*Response, error)
+	// DeliverAll sends the requests concurrently (limited by WithBatchConcurrency and the max concurrency) and returns
+	// a result for each request in the same order. The error is the first error with WithFailFast or else all the
+	// errors joined. Responses with an error status code aren't errors unless the request was retried until the
+	// attempts ran out, then Err is ErrTooManyAttempts (or ErrRetryBudgetExhausted) and Response is the last response.
+	DeliverAll(ctx context.Context, requests []Request, opts ...BatchOpt) ([]Result, error)
 }
 
 // RetryBackoff is an interface for retrying a request with a backoff.
@@ -124,58 +139,83 @@ func NewMinMaxBackoff(min time.Duration, max time.Duration) RetryBackoff {
 }
 
 type http struct {
-	transport   *ghttp.Transport
-	timeout     time.Duration // set for testing but defaults to 55 seconds otherwise
-	dur         time.Duration // set for testing but defaults to 1 second otherwise
-	recorder    Recorder
-	count       uint64
-	semaphore   *semaphore.Weighted
-	maxAttempts uint
-	backoff     RetryBackoff
+	transport     *ghttp.Transport
+	timeout       time.Duration // set for testing but defaults to 55 seconds otherwise
+	dur           time.Duration // set for testing but defaults to 1 second otherwise
+	recorder      Recorder
+	count         uint64
+	semaphore     *semaphore.Weighted
+	maxAttempts   uint
+	backoff       RetryBackoff
+	maxBodySize   int64
+	breaker       *CircuitBreaker
+	maxPerHost    uint64
+	budget        *RetryBudget
+	maxRetryAfter time.Duration
+	retryPolicy   RetryPolicy
+	interceptors  []Interceptor
+	hostsMutex    sync.Mutex
+	hosts         map[string]*hostLimit
+}
+
+// hostLimit limits the concurrent requests to a host and is removed when it isn't being used.
+type hostLimit struct {
+	semaphore *semaphore.Weighted
+	refs      int
 }
 
 var _ Http = (*http)(nil)
 
-func (h *http) shouldRetry(resp *ghttp.Response, err error) bool {
-	if err != nil {
-		msg := err.Error()
-		if strings.Contains(msg, "connection reset") || strings.Contains(msg, "connection refused") || strings.Contains(msg, "EOF") {
-			return true
-		}
+func (h *http) shouldRetry(req Request, resp *ghttp.Response, err error, attempt uint) bool {
+	if h.retryPolicy == nil {
+		return defaultPolicy.ShouldRetry(req, resp, err, attempt)
 	}
-	if resp != nil {
-		switch resp.StatusCode {
-		case ghttp.StatusRequestTimeout, ghttp.StatusBadGateway, ghttp.StatusServiceUnavailable, ghttp.StatusGatewayTimeout, ghttp.StatusTooManyRequests:
-			return true
-		}
+	return h.retryPolicy.ShouldRetry(req, resp, err, attempt)
+}
+
+func (h *http) newResponse(resp *ghttp.Response, attempt uint, latency time.Duration, tracer *timer) *Response {
+	headers := make(map[string]string)
+	for k, v := range resp.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Headers:    headers,
+		Attempts:   attempt,
+		Latency:    latency,
+		Timings:    tracer.result(),
 	}
-	return false
 }
 
-func (h *http) toResponse(resp *ghttp.Response, attempt uint, latency time.Duration) (*Response, error) {
+func (h *http) toResponse(resp *ghttp.Response, attempt uint, latency time.Duration, tracer *timer) (*Response, error) {
 	if resp == nil {
 		return nil, nil
 	}
-	var body []byte
+	response := h.newResponse(resp, attempt, latency, tracer)
 	if resp.Body != nil {
 		defer resp.Body.Close()
-		b, err := io.ReadAll(resp.Body)
+		if err := checkContentLength(resp, h.maxBodySize); err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(&limitedBody{body: resp.Body, max: h.maxBodySize})
 		if err != nil {
 			return nil, err
 		}
-		body = b
+		response.Body = b
 	}
-	headers := make(map[string]string)
-	for k, v := range resp.Header {
-		headers[k] = strings.Join(v, ", ")
+	return response, nil
+}
+
+// toStreamResponse returns the response with the open body which cancels the request context when closed.
+func (h *http) toStreamResponse(resp *ghttp.Response, attempt uint, latency time.Duration, tracer *timer, cancel context.CancelFunc) (*Response, error) {
+	if err := checkContentLength(resp, h.maxBodySize); err != nil {
+		resp.Body.Close()
+		return nil, err
 	}
-	return &Response{
-		StatusCode: resp.StatusCode,
-		Body:       body,
-		Headers:    headers,
-		Attempts:   attempt,
-		Latency:    latency,
-	}, nil
+	response := h.newResponse(resp, attempt, latency, tracer)
+	response.Stream = &limitedBody{body: resp.Body, max: h.maxBodySize, cancel: cancel}
+	return response, nil
 }
 
 var isNumber = regexp.MustCompile("^[0-9]+$")
@@ -185,8 +225,83 @@ func (h *http) generateRequestId(req Request) string {
 	return fmt.Sprintf("%d/%s", count, cstr.NewHash(req.URL(), req.Payload(), time.Now().UnixNano()))
 }
 
+// acquireHost waits for a slot for a request to the host and returns the function which releases it.
+func (h *http) acquireHost(ctx context.Context, host string) (func(), error) {
+	h.hostsMutex.Lock()
+	limit := h.hosts[host]
+	if limit == nil {
+		limit = &hostLimit{semaphore: semaphore.NewWeighted(int64(h.maxPerHost))}
+		h.hosts[host] = limit
+	}
+	limit.refs++
+	h.hostsMutex.Unlock()
+	unref := func() {
+		h.hostsMutex.Lock()
+		defer h.hostsMutex.Unlock()
+		if limit.refs--; limit.refs == 0 {
+			delete(h.hosts, host)
+		}
+	}
+	if err := limit.semaphore.Acquire(ctx, 1); err != nil {
+		unref()
+		return nil, err
+	}
+	return func() {
+		limit.semaphore.Release(1)
+		unref()
+	}, nil
+}
+
+// beforeSend calls the interceptors and checks the circuit breaker before an attempt is sent.
+func (h *http) beforeSend(ctx context.Context, hreq *ghttp.Request, host string) error {
+	for _, interceptor := range h.interceptors {
+		if err := interceptor.BeforeSend(ctx, hreq); err != nil {
+			return err
+		}
+	}
+	if h.breaker != nil {
+		return h.breaker.Allow(host)
+	}
+	return nil
+}
+
+// sentRequest returns a copy of the request with the headers which were sent for the attempt. The payload of a
+// streaming request isn't included since it was only read by the transport.
+func sentRequest(req Request, hreq *ghttp.Request) Request {
+	headers := make(map[string]string, len(hreq.Header))
+	for k, v := range hreq.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	return &HTTPRequest{method: hreq.Method, url: req.URL(), headers: headers, payload: req.Payload()}
+}
+
 func (h *http) Deliver(ctx context.Context, req Request) (*Response, error) {
+	return h.deliver(ctx, req, false)
+}
+
+func (h *http) DeliverStream(ctx context.Context, req Request) (*Response, error) {
+	return h.deliver(ctx, req, true)
+}
+
+func (h *http) DeliverAll(ctx context.Context, reqs []Request, opts ...BatchOpt) ([]Result, error) {
+	return deliverAll(ctx, h.Deliver, reqs, opts)
+}
+
+func (h *http) deliver(ctx context.Context, req Request, stream bool) (*Response, error) {
 	started := time.Now()
+	u, err := url.Parse(req.URL())
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if h.maxPerHost > 0 {
+		// wait for the host before the global semaphore so a slow host doesn't hold slots needed by other hosts
+		release, err := h.acquireHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("error acquiring host semaphore: %w", err)
+		}
+		defer release()
+	}
 	if err := h.semaphore.Acquire(ctx, 1); err != nil {
 		return nil, fmt.Errorf("error acquiring semaphore: %w", err)
 	}
@@ -194,56 +309,103 @@ func (h *http) Deliver(ctx context.Context, req Request) (*Response, error) {
 	var attempt uint
 	var resp *ghttp.Response
 	var response *Response
+	var tracer *timer
 	var c context.Context
 	var cancel context.CancelFunc
 	maxAttempts := h.maxAttempts
+	timeout := h.timeout
 	if maxAttempts == 1 {
 		// for testing we want to make sure we don't wait too long
-		c, cancel = context.WithTimeout(ctx, time.Second*3)
+		timeout = time.Second * 3
 		// we only want to try once for tests
+	}
+	var stopTimeout func() bool
+	if stream {
+		// the timeout only applies until the response headers arrive so reading a large body isn't cut off
+		c, cancel = context.WithCancel(ctx)
+		stopTimeout = time.AfterFunc(timeout, cancel).Stop
 	} else {
-		c, cancel = context.WithTimeout(ctx, h.timeout)
+		c, cancel = context.WithTimeout(ctx, timeout)
 	}
-	defer cancel()
+	var streaming bool
+	defer func() {
+		if stopTimeout != nil {
+			stopTimeout()
+		}
+		// a streamed response body cancels the context when it is closed
+		if !streaming {
+			cancel()
+		}
+	}()
 	headers := req.Headers()
-	if headers == nil {
-		headers = make(map[string]string)
+	if h.budget != nil {
+		h.budget.RecordRequest()
 	}
+	exhausted := ErrTooManyAttempts
 	for attempt < maxAttempts {
 		attempt++
 		reqId := h.generateRequestId(req)
 		var body io.Reader
-		payload := req.Payload()
-		if len(payload) > 0 {
+		sreq, isStream := req.(StreamingRequest)
+		if isStream {
+			rc, err := sreq.Body()
+			if err != nil {
+				return nil, fmt.Errorf("error creating request body: %w", err)
+			}
+			body = rc
+		} else if payload := req.Payload(); len(payload) > 0 {
 			body = bytes.NewBuffer(payload)
 		}
-		hreq, err := ghttp.NewRequestWithContext(c, req.Method(), req.URL(), body)
+		tracer = &timer{}
+		hreq, err := ghttp.NewRequestWithContext(tracer.trace(c), req.Method(), req.URL(), body)
 		if err != nil {
 			return nil, err
 		}
+		if isStream {
+			// allows the transport to send the body again if the connection is lost before the response
+			hreq.GetBody = sreq.Body
+		}
 		for k, v := range headers {
 			hreq.Header.Set(k, v)
 		}
 		hreq.Header.Set("User-Agent", userAgentHeaderValue)
 		hreq.Header.Set("X-Request-Id", reqId)
 		hreq.Header.Set("X-Attempt", strconv.Itoa(int(attempt)))
+		if err := h.beforeSend(c, hreq, host); err != nil {
+			if hreq.Body != nil {
+				hreq.Body.Close()
+			}
+			return nil, err
+		}
 		resp, err = h.transport.RoundTrip(hreq)
+		if h.breaker != nil {
+			if errors.Is(err, context.Canceled) {
+				h.breaker.release(host)
+			} else {
+				h.breaker.Record(host, err == nil && resp.StatusCode < ghttp.StatusInternalServerError)
+			}
+		}
+		for i := len(h.interceptors) - 1; i >= 0; i-- {
+			h.interceptors[i].AfterResponse(c, hreq, resp, err)
+		}
 		if err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) {
 			return nil, err
 		}
 		if h.recorder != nil && resp != nil /*&& !req.TestOnly*/ {
-			r, err := h.toResponse(resp, attempt, time.Since(started))
-			if err != nil {
-				return nil, fmt.Errorf("error converting response: %w", err)
+			var r *Response
+			if stream {
+				// the body is left for the caller to read so the recorder only gets the status and headers
+				r = h.newResponse(resp, attempt, time.Since(started), tracer)
+			} else {
+				r, err = h.toResponse(resp, attempt, time.Since(started), tracer)
+				if err != nil {
+					return nil, fmt.Errorf("error converting response: %w", err)
+				}
+				response = r // set it so we don't try and re-read the body again
 			}
-			// update our headers
-			headers["User-Agent"] = userAgentHeaderValue
-			headers["X-Request-Id"] = reqId
-			headers["X-Attempt"] = strconv.Itoa(int(attempt))
-			h.recorder.OnResponse(ctx, req, r)
-			response = r // set it so we don't try and re-read the body again
+			h.recorder.OnResponse(ctx, sentRequest(req, hreq), r)
 		}
-		if h.shouldRetry(resp, err) /*&& !req.TestOnly*/ {
+		if h.shouldRetry(req, resp, err, attempt) /*&& !req.TestOnly*/ {
 			select {
 			case <-ctx.Done():
 				return nil, context.Canceled
@@ -253,6 +415,10 @@ func (h *http) Deliver(ctx context.Context, req Request) (*Response, error) {
 				// don't worry about sleeping and reading the body if we're not going to retry
 				break
 			}
+			if h.budget != nil && !h.budget.AllowRetry() {
+				exhausted = ErrRetryBudgetExhausted
+				break
+			}
 			ms := h.dur * time.Duration(attempt)
 			if h.backoff != nil {
 				ms = h.backoff.BackOff(attempt)
@@ -272,39 +438,64 @@ func (h *http) Deliver(ctx context.Context, req Request) (*Response, error) {
 							ms = time.Until(tv)
 						}
 					}
+					if h.maxRetryAfter > 0 && ms > h.maxRetryAfter {
+						ms = h.maxRetryAfter
+					}
 				}
 			}
-			if ms > 0 {
-				time.Sleep(ms)
+			if err := wait(c, ms); err != nil {
+				return nil, err
 			}
 			continue
 		}
 		if err != nil {
 			return nil, err
 		}
+		if stream {
+			r, err := h.toStreamResponse(resp, attempt, time.Since(started), tracer, cancel)
+			streaming = err == nil
+			return r, err
+		}
 		if response == nil {
-			return h.toResponse(resp, attempt, time.Since(started))
+			return h.toResponse(resp, attempt, time.Since(started), tracer)
 		}
 		return response, nil
 	}
+	if stream && resp != nil {
+		r, err := h.toStreamResponse(resp, attempt, time.Since(started), tracer, cancel)
+		if err != nil {
+			return nil, err
+		}
+		streaming = true
+		return r, exhausted
+	}
 	if response == nil && resp != nil {
-		r, err := h.toResponse(resp, attempt, time.Since(started))
+		r, err := h.toResponse(resp, attempt, time.Since(started), tracer)
 		if err != nil {
 			return nil, err
 		}
-		return r, ErrTooManyAttempts
+		return r, exhausted
 	}
-	return response, ErrTooManyAttempts
+	return response, exhausted
 }
 
 type configOpts struct {
-	recorder    Recorder
-	max         uint64
-	dns         dns.DNS
-	timeout     time.Duration
-	dur         time.Duration
-	maxAttempts uint
-	backoff     RetryBackoff
+	recorder      Recorder
+	max           uint64
+	dns           dns.DNS
+	timeout       time.Duration
+	dur           time.Duration
+	maxAttempts   uint
+	backoff       RetryBackoff
+	guard         *dns.Guard
+	transport     transportOpts
+	maxBodySize   int64
+	breaker       *CircuitBreaker
+	maxPerHost    uint64
+	budget        *RetryBudget
+	maxRetryAfter time.Duration
+	retryPolicy   RetryPolicy
+	interceptors  []Interceptor
 }
 
 type ConfigOpt func(opts *configOpts)
@@ -317,6 +508,11 @@ func New(opts ...ConfigOpt) Http {
 	c.max = 100
 	c.maxAttempts = 4
 	c.backoff = NewMinMaxBackoff(time.Millisecond*50, time.Second*10)
+	c.maxRetryAfter = time.Second * 30
+	c.transport.maxIdleConns = defaultMaxIdleConns
+	c.transport.maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	c.transport.idleConnTimeout = defaultIdleConnTimeout
+	c.transport.tlsHandshakeTimeout = defaultTLSHandshakeTimeout
 	for _, opt := range opts {
 		opt(&c)
 	}
@@ -326,37 +522,22 @@ func New(opts ...ConfigOpt) Http {
 	if c.maxAttempts <= 0 {
 		panic("maxAttempts was nil")
 	}
-	var transport *ghttp.Transport
-	if c.dns != nil {
-		transport = &ghttp.Transport{
-			DialContext: func(ctx context.Context, network string, addr string) (conn net.Conn, err error) {
-				host, port, err := net.SplitHostPort(addr)
-				if err != nil {
-					return nil, err
-				}
-				ok, ip, err := c.dns.Lookup(ctx, host)
-				if err != nil {
-					return nil, err
-				}
-				if !ok {
-					return nil, fmt.Errorf("dns lookup failed: couldn't find ip for %s", host)
-				}
-				var dialer net.Dialer
-				conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
-				return
-			},
-		}
-	} else {
-		transport = ghttp.DefaultTransport.(*ghttp.Transport)
-	}
 	return &http{
-		transport:   transport,
-		timeout:     c.timeout,
-		dur:         c.dur,
-		recorder:    c.recorder,
-		semaphore:   semaphore.NewWeighted(int64(c.max)),
-		maxAttempts: c.maxAttempts,
-		backoff:     c.backoff,
+		transport:     newTransport(&c),
+		timeout:       c.timeout,
+		dur:           c.dur,
+		recorder:      c.recorder,
+		semaphore:     semaphore.NewWeighted(int64(c.max)),
+		maxAttempts:   c.maxAttempts,
+		backoff:       c.backoff,
+		maxBodySize:   c.maxBodySize,
+		breaker:       c.breaker,
+		maxPerHost:    c.maxPerHost,
+		budget:        c.budget,
+		maxRetryAfter: c.maxRetryAfter,
+		retryPolicy:   c.retryPolicy,
+		interceptors:  c.interceptors,
+		hosts:         make(map[string]*hostLimit),
 	}
 }
 
@@ -367,6 +548,15 @@ func WithDNS(dns dns.DNS) ConfigOpt {
 	}
 }
 
+// WithSSRFGuard blocks requests to hosts and addresses blocked by the guard. The address is checked when
+// connecting so hostnames which resolve (or are rebound) to a blocked address are also blocked.
+// Proxies from the environment aren't used when a guard is set.
+func WithSSRFGuard(guard *dns.Guard) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.guard = guard
+	}
+}
+
 // WithRecorder sets the recorder for the http client.
 func WithRecorder(recorder Recorder) ConfigOpt {
 	return func(opts *configOpts) {
@@ -381,6 +571,21 @@ func WithMaxConcurrency(max uint64) ConfigOpt {
 	}
 }
 
+// WithMaxConcurrencyPerHost sets the max number of concurrent requests to each host in addition to the overall max.
+func WithMaxConcurrencyPerHost(max uint64) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.maxPerHost = max
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker which stops sending requests to failing hosts. Requests to a host
+// with an open circuit fail with a CircuitOpenError (matching ErrCircuitOpen) without being sent.
+func WithCircuitBreaker(breaker *CircuitBreaker) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.breaker = breaker
+	}
+}
+
 // WithTimeout sets the timeout for the http client.
 func WithTimeout(timeout time.Duration) ConfigOpt {
 	return func(opts *configOpts) {
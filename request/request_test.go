@@ -3,12 +3,16 @@ package request
 import (
 	"context"
 	"fmt"
+	"net"
 	ghttp "net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/shopmonkeyus/go-common/cache"
+	"github.com/shopmonkeyus/go-common/dns"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/semaphore"
 )
@@ -57,7 +61,7 @@ func TestHTTPRetry(t *testing.T) {
 		w.Write([]byte(`{"message":"hello"}`))
 	}))
 	defer srv.Close()
-	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{}, nil))
+	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{"Idempotency-Key": "test"}, nil))
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
@@ -83,7 +87,7 @@ func TestHTTPRetryWithRetryAfterHeader(t *testing.T) {
 		w.Write([]byte(`{"message":"hello"}`))
 	}))
 	defer srv.Close()
-	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{}, nil))
+	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{"Idempotency-Key": "test"}, nil))
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
@@ -110,7 +114,7 @@ func TestHTTPRetryWithRetryAfterHeaderAsTime(t *testing.T) {
 		w.Write([]byte(`{"message":"hello"}`))
 	}))
 	defer srv.Close()
-	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{}, nil))
+	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{"Idempotency-Key": "test"}, nil))
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
@@ -134,7 +138,7 @@ func TestHTTPRetryTimeout(t *testing.T) {
 		w.WriteHeader(ghttp.StatusBadGateway)
 	}))
 	defer srv.Close()
-	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{}, nil))
+	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{"Idempotency-Key": "test"}, nil))
 	assert.Error(t, err, ErrTooManyAttempts)
 	assert.NotNil(t, resp)
 	assert.Equal(t, ghttp.StatusBadGateway, resp.StatusCode)
@@ -169,7 +173,7 @@ func TestHTTPRecorder(t *testing.T) {
 		w.WriteHeader(ghttp.StatusBadGateway)
 	}))
 	defer srv.Close()
-	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{}, nil))
+	resp, err := h.Deliver(context.Background(), NewHTTPRequest(ghttp.MethodPost, srv.URL, map[string]string{"Idempotency-Key": "test"}, nil))
 	assert.Error(t, err, ErrTooManyAttempts)
 	assert.NotNil(t, resp)
 	assert.Equal(t, ghttp.StatusBadGateway, resp.StatusCode)
@@ -259,3 +263,67 @@ func TestHTTPBackoff(t *testing.T) {
 	assert.Equal(t, uint(3), tr.resp.Attempts)
 	assert.Equal(t, uint(2), tb.count)
 }
+
+func TestHTTPSSRFGuard(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	guard, err := dns.NewGuard()
+	assert.NoError(t, err)
+	h := New(WithSSRFGuard(guard), WithMaxAttempts(1))
+	_, err = h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, dns.ErrInvalidIP)
+	_, err = h.Deliver(context.Background(), NewHTTPGetRequest("http://metadata.google.internal/computeMetadata/v1/", nil))
+	assert.ErrorIs(t, err, dns.ErrInvalidIP)
+
+	guard, err = dns.NewGuard(dns.WithAllowCIDRs("127.0.0.1/32"))
+	assert.NoError(t, err)
+	h = New(WithSSRFGuard(guard), WithMaxAttempts(1))
+	resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+}
+
+func TestHTTPSSRFGuardWithDNS(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	guard, err := dns.NewGuard()
+	assert.NoError(t, err)
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	// the dns resolver allows local addresses but the dial is still checked by the guard
+	h := New(WithDNS(dns.New(c)), WithSSRFGuard(guard), WithMaxAttempts(1))
+	_, err = h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, dns.ErrInvalidIP)
+}
+
+func TestHTTPTimings(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	c.Set("dns:example.test", []net.IP{net.ParseIP("127.0.0.1")}, time.Minute)
+	h := New(WithDNS(dns.New(c)), WithMaxAttempts(1))
+	resp, err := h.Deliver(context.Background(), NewHTTPGetRequest("http://example.test:"+u.Port(), nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.NotNil(t, resp.Timings)
+	assert.True(t, resp.Timings.DNSCached)
+	assert.Greater(t, resp.Timings.DNS, time.Duration(0))
+	assert.Greater(t, resp.Timings.Connect, time.Duration(0))
+	assert.GreaterOrEqual(t, resp.Timings.TTFB, 10*time.Millisecond)
+	assert.False(t, resp.Timings.ReusedConn)
+
+	resp, err = h.Deliver(context.Background(), NewHTTPGetRequest("http://example.test:"+u.Port(), nil))
+	assert.NoError(t, err)
+	assert.True(t, resp.Timings.ReusedConn)
+	assert.Equal(t, time.Duration(0), resp.Timings.Connect)
+}
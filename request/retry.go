@@ -0,0 +1,157 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	ghttp "net/http"
+	"strings"
+	"syscall"
+)
+
+// RetryPolicy decides if an attempt should be retried.
+type RetryPolicy interface {
+	// ShouldRetry returns true if the request should be retried after the attempt. The response is nil if
+	// there was an error.
+	ShouldRetry(req Request, resp *ghttp.Response, err error, attempt uint) bool
+}
+
+// RetryPredicate returns true if the attempt should be retried.
+type RetryPredicate func(req Request, resp *ghttp.Response, err error) bool
+
+type retryPolicyOpts struct {
+	statusCodes []int
+	predicates  []RetryPredicate
+}
+
+type RetryPolicyOpt func(opts *retryPolicyOpts)
+
+// WithRetryStatusCodes retries responses with the status codes in addition to the default status codes.
+func WithRetryStatusCodes(codes ...int) RetryPolicyOpt {
+	return func(opts *retryPolicyOpts) {
+		opts.statusCodes = append(opts.statusCodes, codes...)
+	}
+}
+
+// WithRetryPredicate retries attempts when the predicate returns true in addition to the default conditions.
+func WithRetryPredicate(predicate RetryPredicate) RetryPolicyOpt {
+	return func(opts *retryPolicyOpts) {
+		opts.predicates = append(opts.predicates, predicate)
+	}
+}
+
+type defaultRetryPolicy struct {
+	statusCodes map[int]bool
+	extraCodes  map[int]bool
+	predicates  []RetryPredicate
+}
+
+var _ RetryPolicy = (*defaultRetryPolicy)(nil)
+
+// NewRetryPolicy returns the default RetryPolicy which retries connection errors, timeouts and the 408, 429,
+// 502, 503 and 504 status codes. Requests which aren't idempotent (such as POST) are only retried if they
+// have an Idempotency-Key header, the connection failed before the request was sent or the server rejected
+// the request with 429 or 503 without processing it. The predicates and status codes from the options are
+// retried for every method.
+func NewRetryPolicy(opts ...RetryPolicyOpt) RetryPolicy {
+	var config retryPolicyOpts
+	for _, opt := range opts {
+		opt(&config)
+	}
+	policy := &defaultRetryPolicy{
+		statusCodes: map[int]bool{
+			ghttp.StatusRequestTimeout:     true,
+			ghttp.StatusTooManyRequests:    true,
+			ghttp.StatusBadGateway:         true,
+			ghttp.StatusServiceUnavailable: true,
+			ghttp.StatusGatewayTimeout:     true,
+		},
+		extraCodes: make(map[int]bool),
+		predicates: config.predicates,
+	}
+	for _, code := range config.statusCodes {
+		policy.extraCodes[code] = true
+	}
+	return policy
+}
+
+func (p *defaultRetryPolicy) ShouldRetry(req Request, resp *ghttp.Response, err error, attempt uint) bool {
+	if err != nil && isDialError(err) && isRetryableError(err) {
+		// the request was never sent so it is safe to retry any method
+		return true
+	}
+	for _, predicate := range p.predicates {
+		if predicate(req, resp, err) {
+			return true
+		}
+	}
+	if resp != nil {
+		if resp.StatusCode == ghttp.StatusTooManyRequests || resp.StatusCode == ghttp.StatusServiceUnavailable {
+			// the server didn't process the request so it is safe to retry any method
+			return true
+		}
+	}
+	if !isIdempotent(req) {
+		return false
+	}
+	if err != nil {
+		return isRetryableError(err)
+	}
+	return resp != nil && (p.statusCodes[resp.StatusCode] || p.extraCodes[resp.StatusCode])
+}
+
+var defaultPolicy = NewRetryPolicy()
+
+// isIdempotent returns true if the request method is idempotent (RFC 9110) or the request has an Idempotency-Key header.
+func isIdempotent(req Request) bool {
+	switch req.Method() {
+	case ghttp.MethodGet, ghttp.MethodHead, ghttp.MethodOptions, ghttp.MethodTrace, ghttp.MethodPut, ghttp.MethodDelete:
+		return true
+	}
+	for k, v := range req.Headers() {
+		if strings.EqualFold(k, "Idempotency-Key") && v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isDialError returns true if the error happened connecting to the server before anything was sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isRetryableError returns true if the error is a temporary network error.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) {
+		// the same certificate will be returned next time
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// WithRetryPolicy sets the policy which decides if a request is retried, defaults to NewRetryPolicy().
+func WithRetryPolicy(policy RetryPolicy) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.retryPolicy = policy
+	}
+}
@@ -0,0 +1,115 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	ghttp "net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryPolicy(t *testing.T) {
+	policy := NewRetryPolicy()
+	get := NewHTTPGetRequest("http://example.test", nil)
+	post := NewHTTPPostRequest("http://example.test", nil, []byte("{}"))
+	keyed := NewHTTPPostRequest("http://example.test", map[string]string{"idempotency-key": "abc"}, []byte("{}"))
+
+	badGateway := &ghttp.Response{StatusCode: ghttp.StatusBadGateway}
+	assert.True(t, policy.ShouldRetry(get, badGateway, nil, 1))
+	assert.False(t, policy.ShouldRetry(post, badGateway, nil, 1), "shouldn't retry a POST without an idempotency key")
+	assert.True(t, policy.ShouldRetry(keyed, badGateway, nil, 1))
+	assert.True(t, policy.ShouldRetry(post, &ghttp.Response{StatusCode: ghttp.StatusTooManyRequests}, nil, 1), "the POST wasn't processed")
+	assert.True(t, policy.ShouldRetry(post, &ghttp.Response{StatusCode: ghttp.StatusServiceUnavailable}, nil, 1), "the POST wasn't processed")
+	assert.False(t, policy.ShouldRetry(get, &ghttp.Response{StatusCode: ghttp.StatusInternalServerError}, nil, 1))
+	assert.False(t, policy.ShouldRetry(get, &ghttp.Response{StatusCode: ghttp.StatusOK}, nil, 1))
+
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	assert.True(t, policy.ShouldRetry(get, nil, reset, 1))
+	assert.False(t, policy.ShouldRetry(post, nil, reset, 1), "the POST may have been processed")
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	assert.True(t, policy.ShouldRetry(post, nil, refused, 1), "the POST was never sent")
+	assert.True(t, policy.ShouldRetry(get, nil, fmt.Errorf("error: %w", io.ErrUnexpectedEOF), 1))
+	assert.True(t, policy.ShouldRetry(get, nil, &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, 1))
+	assert.False(t, policy.ShouldRetry(get, nil, errors.New("unsupported protocol scheme"), 1))
+	assert.False(t, policy.ShouldRetry(get, nil, context.Canceled, 1))
+	assert.False(t, policy.ShouldRetry(get, nil, &net.DNSError{Err: "no such host", IsNotFound: true}, 1))
+
+	policy = NewRetryPolicy(WithRetryStatusCodes(ghttp.StatusInternalServerError), WithRetryPredicate(func(req Request, resp *ghttp.Response, err error) bool {
+		return resp != nil && resp.Header.Get("X-Retry") == "true"
+	}))
+	assert.True(t, policy.ShouldRetry(get, &ghttp.Response{StatusCode: ghttp.StatusInternalServerError}, nil, 1))
+	assert.True(t, policy.ShouldRetry(get, &ghttp.Response{StatusCode: ghttp.StatusConflict, Header: ghttp.Header{"X-Retry": {"true"}}}, nil, 1))
+	assert.True(t, policy.ShouldRetry(get, badGateway, nil, 1), "should keep the default status codes")
+	assert.False(t, policy.ShouldRetry(post, &ghttp.Response{StatusCode: ghttp.StatusInternalServerError}, nil, 1), "should keep the idempotency check for the extra status codes")
+	assert.True(t, policy.ShouldRetry(keyed, &ghttp.Response{StatusCode: ghttp.StatusInternalServerError}, nil, 1))
+	assert.True(t, policy.ShouldRetry(post, &ghttp.Response{StatusCode: ghttp.StatusConflict, Header: ghttp.Header{"X-Retry": {"true"}}}, nil, 1), "should check the predicates for any method")
+	assert.False(t, policy.ShouldRetry(post, badGateway, nil, 1), "should keep the idempotency check for the default status codes")
+}
+
+type countingPolicy struct {
+	attempts []uint
+}
+
+func (p *countingPolicy) ShouldRetry(req Request, resp *ghttp.Response, err error, attempt uint) bool {
+	p.attempts = append(p.attempts, attempt)
+	return resp != nil && resp.StatusCode == ghttp.StatusConflict
+}
+
+func TestHTTPRetryPolicy(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		if count < 3 {
+			w.WriteHeader(ghttp.StatusConflict)
+			return
+		}
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	var policy countingPolicy
+	h := New(WithRetryPolicy(&policy), WithBackoff(NewFullJitterBackoff(0, 0)))
+	resp, err := h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Equal(t, []uint{1, 2, 3}, policy.attempts)
+
+}
+
+func TestHTTPRetryPostWithoutIdempotencyKey(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		w.WriteHeader(ghttp.StatusBadGateway)
+	}))
+	defer srv.Close()
+	resp, err := New().Deliver(context.Background(), NewHTTPPostRequest(srv.URL, nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, 1, count)
+}
+
+func TestHTTPRetryStatusCodesPostWithoutIdempotencyKey(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		count++
+		w.WriteHeader(ghttp.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	h := New(WithRetryPolicy(NewRetryPolicy(WithRetryStatusCodes(ghttp.StatusInternalServerError))), WithBackoff(NewFullJitterBackoff(0, 0)))
+	resp, err := h.Deliver(context.Background(), NewHTTPPostRequest(srv.URL, nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,86 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	ghttp "net/http"
+)
+
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// StreamingRequest is a Request with a body which is streamed from a reader instead of the payload.
+type StreamingRequest interface {
+	Request
+	// Body returns a new reader for the body. It is called for each attempt so the body can be sent again
+	// when the request is retried.
+	Body() (io.ReadCloser, error)
+}
+
+type HTTPStreamRequest struct {
+	HTTPRequest
+	body func() (io.ReadCloser, error)
+}
+
+var _ StreamingRequest = (*HTTPStreamRequest)(nil)
+
+func (r *HTTPStreamRequest) Body() (io.ReadCloser, error) {
+	return r.body()
+}
+
+// NewHTTPStreamRequest creates a new HTTPStreamRequest that implements the StreamingRequest interface. The body
+// function is called to create a new reader for each attempt.
+func NewHTTPStreamRequest(method string, url string, headers map[string]string, body func() (io.ReadCloser, error)) Request {
+	return &HTTPStreamRequest{HTTPRequest{method, url, headers, nil}, body}
+}
+
+// limitedBody is a response body which returns ErrBodyTooLarge if more than max bytes are read and cancels
+// the request context when closed.
+type limitedBody struct {
+	body   io.ReadCloser
+	max    int64 // 0 for no limit
+	read   int64
+	cancel context.CancelFunc
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.max > 0 {
+		if b.read > b.max {
+			return 0, ErrBodyTooLarge
+		}
+		// read at most one byte past the limit so we can tell if the body is too large
+		if remaining := b.max - b.read + 1; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if b.max > 0 && b.read > b.max {
+		return n - int(b.read-b.max), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	err := b.body.Close()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return err
+}
+
+// checkContentLength returns ErrBodyTooLarge if the response says its body is larger than max.
+func checkContentLength(resp *ghttp.Response, max int64) error {
+	if max > 0 && resp.ContentLength > max {
+		return ErrBodyTooLarge
+	}
+	return nil
+}
+
+// WithMaxBodySize sets the max size of a response body in bytes. Reading a larger body returns ErrBodyTooLarge
+// instead of buffering it. Defaults to no limit.
+func WithMaxBodySize(max int64) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.maxBodySize = max
+	}
+}
@@ -0,0 +1,124 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"io"
+	ghttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPStreamRequestBody(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "hello streaming world", string(body))
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(ghttp.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	defer srv.Close()
+	var bodies int32
+	req := NewHTTPStreamRequest(ghttp.MethodPut, srv.URL, nil, func() (io.ReadCloser, error) {
+		atomic.AddInt32(&bodies, 1)
+		return io.NopCloser(strings.NewReader("hello streaming world")), nil
+	})
+	h := New(WithBackoff(NewMinMaxBackoff(time.Millisecond, time.Millisecond)))
+	resp, err := h.Deliver(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Equal(t, uint(2), resp.Attempts)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&bodies), "should create a new body for each attempt")
+}
+
+func TestHTTPDeliverStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 64*1024)
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.WriteHeader(ghttp.StatusOK)
+		w.Write(payload)
+	}))
+	defer srv.Close()
+	h := New(WithMaxAttempts(1))
+	resp, err := h.DeliverStream(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body)
+	assert.NotNil(t, resp.Stream)
+	// the body should still be readable after DeliverStream returns
+	time.Sleep(10 * time.Millisecond)
+	body, err := io.ReadAll(resp.Stream)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, body)
+	assert.NoError(t, resp.Stream.Close())
+}
+
+func TestHTTPDeliverStreamOutlivesTimeout(t *testing.T) {
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		w.WriteHeader(ghttp.StatusOK)
+		w.Write([]byte("first"))
+		w.(ghttp.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("second"))
+	}))
+	defer srv.Close()
+	h := New(WithMaxAttempts(2), WithTimeout(100*time.Millisecond))
+	resp, err := h.DeliverStream(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Stream)
+	assert.NoError(t, err, "the timeout shouldn't apply to reading the body")
+	assert.Equal(t, "firstsecond", string(body))
+	assert.NoError(t, resp.Stream.Close())
+
+	slow := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	started := time.Now()
+	_, err = h.DeliverStream(context.Background(), NewHTTPGetRequest(slow.URL, nil))
+	assert.Error(t, err, "the timeout should apply until the headers arrive")
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestHTTPMaxBodySize(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 1024)
+	srv := httptest.NewServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", "1024")
+		}
+		w.WriteHeader(ghttp.StatusOK)
+		w.Write(payload)
+		w.(ghttp.Flusher).Flush()
+	}))
+	defer srv.Close()
+
+	h := New(WithMaxAttempts(1), WithMaxBodySize(1024))
+	resp, err := h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Len(t, resp.Body, 1024)
+
+	h = New(WithMaxAttempts(1), WithMaxBodySize(100))
+	_, err = h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	_, err = h.Deliver(context.Background(), NewHTTPGetRequest(srv.URL+"?chunked=1", nil))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	_, err = h.DeliverStream(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	resp, err = h.DeliverStream(context.Background(), NewHTTPGetRequest(srv.URL+"?chunked=1", nil))
+	assert.NoError(t, err)
+	defer resp.Stream.Close()
+	body, err := io.ReadAll(resp.Stream)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Len(t, body, 100)
+}
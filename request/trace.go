@@ -0,0 +1,105 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/dns"
+)
+
+// Timings are the durations of the phases of the last attempt of a request. The DNS, connect and TLS
+// durations are zero when an idle connection was reused.
+type Timings struct {
+	DNS        time.Duration `json:"dns"`
+	DNSCached  bool          `json:"dnsCached"`
+	Connect    time.Duration `json:"connect"`
+	TLS        time.Duration `json:"tls"`
+	TTFB       time.Duration `json:"ttfb"` // from getting a connection until the first response byte
+	ReusedConn bool          `json:"reusedConn"`
+}
+
+// timer collects the timings of an attempt using httptrace and dns.ClientTrace hooks.
+type timer struct {
+	mu           sync.Mutex
+	gotConn      time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timings      Timings
+}
+
+// trace returns a context which records the timings of requests made with it.
+func (t *timer) trace(ctx context.Context) context.Context {
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		// the net.Resolver hooks are only called when we aren't using our own dns resolver
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(network string, addr string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network string, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && t.timings.Connect == 0 {
+				t.timings.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.TLS = time.Since(t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.ReusedConn = info.Reused
+			t.gotConn = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.TTFB = time.Since(t.gotConn)
+		},
+	})
+	return dns.WithClientTrace(ctx, &dns.ClientTrace{
+		LookupStart: func(dns.LookupStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		LookupDone: func(info dns.LookupDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.DNS = time.Since(t.dnsStart)
+			t.timings.DNSCached = info.Cached
+		},
+	})
+}
+
+// result returns a copy of the timings collected so far.
+func (t *timer) result() *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := t.timings
+	return &timings
+}
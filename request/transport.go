@@ -0,0 +1,201 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	ghttp "net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+)
+
+type transportOpts struct {
+	maxIdleConns          int
+	maxIdleConnsPerHost   int
+	idleConnTimeout       time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+	tlsConfig             *tls.Config
+	rootCAs               *x509.CertPool
+	certificates          []tls.Certificate
+	minTLSVersion         uint16
+	proxy                 func(*ghttp.Request) (*url.URL, error)
+	disableHTTP2          bool
+}
+
+// newTLSConfig returns the tls config for the transport which requires at least TLS 1.2 unless a lower
+// version is configured.
+func (o *transportOpts) newTLSConfig() *tls.Config {
+	var config *tls.Config
+	if o.tlsConfig != nil {
+		config = o.tlsConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if o.rootCAs != nil {
+		config.RootCAs = o.rootCAs
+	}
+	config.Certificates = append(config.Certificates, o.certificates...)
+	if o.minTLSVersion != 0 {
+		config.MinVersion = o.minTLSVersion
+	} else if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	return config
+}
+
+// newTransport returns a new transport for the config. A new transport is always created so changes to it
+// (or to http.DefaultTransport) aren't shared.
+func newTransport(c *configOpts) *ghttp.Transport {
+	dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: defaultKeepAlive}
+	if c.guard != nil {
+		// check the address actually being connected to so a hostname can't be rebound to a blocked address after it is checked
+		dialer.Control = c.guard.Control
+	}
+	transport := &ghttp.Transport{
+		DialContext:           dialContext(c, dialer),
+		MaxIdleConns:          c.transport.maxIdleConns,
+		MaxIdleConnsPerHost:   c.transport.maxIdleConnsPerHost,
+		IdleConnTimeout:       c.transport.idleConnTimeout,
+		TLSHandshakeTimeout:   c.transport.tlsHandshakeTimeout,
+		ResponseHeaderTimeout: c.transport.responseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       c.transport.newTLSConfig(),
+		ForceAttemptHTTP2:     !c.transport.disableHTTP2,
+	}
+	if c.transport.disableHTTP2 {
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) ghttp.RoundTripper)
+	}
+	switch {
+	case c.guard != nil:
+		// a proxy would be dialed instead of the destination so the destination address couldn't be checked
+	case c.transport.proxy != nil:
+		transport.Proxy = c.transport.proxy
+	case c.dns == nil:
+		// a proxy would resolve the destination instead of our dns resolver so only use the environment without one
+		transport.Proxy = ghttp.ProxyFromEnvironment
+	}
+	return transport
+}
+
+// dialContext returns the function used to dial connections which resolves the host with the dns resolver and
+// checks it with the guard if they are configured.
+func dialContext(c *configOpts, dialer *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if c.dns == nil && c.guard == nil {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if c.guard != nil {
+			if err := c.guard.CheckHost(host); err != nil {
+				return nil, err
+			}
+		}
+		if c.dns == nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		ok, ip, err := c.dns.Lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("dns lookup failed: couldn't find ip for %s", host)
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the max number of idle (keep-alive) connections kept for each host, defaults to 10.
+func WithMaxIdleConnsPerHost(max int) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.maxIdleConnsPerHost = max
+	}
+}
+
+// WithMaxIdleConns sets the max number of idle (keep-alive) connections kept across all hosts, defaults to 100.
+func WithMaxIdleConns(max int) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.maxIdleConns = max
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept before it is closed, defaults to 90 seconds.
+func WithIdleConnTimeout(timeout time.Duration) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.idleConnTimeout = timeout
+	}
+}
+
+// WithTLSHandshakeTimeout sets the max time to wait for a TLS handshake, defaults to 10 seconds.
+func WithTLSHandshakeTimeout(timeout time.Duration) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.tlsHandshakeTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout sets the max time to wait for the response headers after the request is written.
+// By default only the overall timeout applies.
+func WithResponseHeaderTimeout(timeout time.Duration) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.responseHeaderTimeout = timeout
+	}
+}
+
+// WithTLSConfig sets the base TLS config for the http client. The config is cloned and combined with the
+// other TLS options.
+func WithTLSConfig(config *tls.Config) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.tlsConfig = config
+	}
+}
+
+// WithRootCAs sets the certificate authorities used to verify servers instead of the system pool.
+func WithRootCAs(pool *x509.CertPool) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.rootCAs = pool
+	}
+}
+
+// WithClientCertificates adds the certificates presented to servers which require client authentication.
+func WithClientCertificates(certs ...tls.Certificate) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.certificates = append(opts.transport.certificates, certs...)
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version (such as tls.VersionTLS13), defaults to TLS 1.2.
+func WithMinTLSVersion(version uint16) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.minTLSVersion = version
+	}
+}
+
+// WithProxy sets the proxy for the http client (for example http.ProxyURL). By default the proxy from the
+// environment is used unless a dns resolver or SSRF guard is set. The proxy isn't used when a guard is set.
+func WithProxy(proxy func(*ghttp.Request) (*url.URL, error)) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.proxy = proxy
+	}
+}
+
+// WithHTTP2 enables or disables HTTP/2 for https requests, enabled by default.
+func WithHTTP2(enabled bool) ConfigOpt {
+	return func(opts *configOpts) {
+		opts.transport.disableHTTP2 = !enabled
+	}
+}
@@ -0,0 +1,98 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	ghttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/cache"
+	"github.com/shopmonkeyus/go-common/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportDefaults(t *testing.T) {
+	h := New().(*http)
+	assert.NotSame(t, ghttp.DefaultTransport, h.transport)
+	assert.Equal(t, 10, h.transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 100, h.transport.MaxIdleConns)
+	assert.Equal(t, 90*time.Second, h.transport.IdleConnTimeout)
+	assert.Equal(t, 10*time.Second, h.transport.TLSHandshakeTimeout)
+	assert.Equal(t, uint16(tls.VersionTLS12), h.transport.TLSClientConfig.MinVersion)
+	assert.True(t, h.transport.ForceAttemptHTTP2)
+	assert.NotNil(t, h.transport.Proxy, "should use the proxy from the environment")
+
+	c := cache.NewInMemory(context.Background(), time.Minute)
+	defer c.Close()
+	h = New(WithDNS(dns.New(c))).(*http)
+	assert.Nil(t, h.transport.Proxy, "shouldn't use the environment proxy with a dns resolver")
+
+	proxy := ghttp.ProxyURL(&url.URL{Scheme: "http", Host: "proxy.test:3128"})
+	h = New(WithDNS(dns.New(c)), WithProxy(proxy)).(*http)
+	assert.NotNil(t, h.transport.Proxy)
+
+	guard, err := dns.NewGuard()
+	assert.NoError(t, err)
+	h = New(WithSSRFGuard(guard), WithProxy(proxy)).(*http)
+	assert.Nil(t, h.transport.Proxy, "shouldn't use a proxy with a guard")
+}
+
+func TestTransportOptions(t *testing.T) {
+	pool := x509.NewCertPool()
+	cert := tls.Certificate{Certificate: [][]byte{{1}}}
+	h := New(
+		WithMaxIdleConnsPerHost(5),
+		WithMaxIdleConns(20),
+		WithIdleConnTimeout(time.Minute),
+		WithTLSHandshakeTimeout(time.Second),
+		WithResponseHeaderTimeout(2*time.Second),
+		WithTLSConfig(&tls.Config{ServerName: "example.test"}),
+		WithRootCAs(pool),
+		WithClientCertificates(cert),
+		WithMinTLSVersion(tls.VersionTLS13),
+		WithHTTP2(false),
+	).(*http)
+	assert.Equal(t, 5, h.transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, h.transport.MaxIdleConns)
+	assert.Equal(t, time.Minute, h.transport.IdleConnTimeout)
+	assert.Equal(t, time.Second, h.transport.TLSHandshakeTimeout)
+	assert.Equal(t, 2*time.Second, h.transport.ResponseHeaderTimeout)
+	assert.Equal(t, "example.test", h.transport.TLSClientConfig.ServerName)
+	assert.Same(t, pool, h.transport.TLSClientConfig.RootCAs)
+	assert.Len(t, h.transport.TLSClientConfig.Certificates, 1)
+	assert.Equal(t, uint16(tls.VersionTLS13), h.transport.TLSClientConfig.MinVersion)
+	assert.False(t, h.transport.ForceAttemptHTTP2)
+	assert.NotNil(t, h.transport.TLSNextProto)
+}
+
+func TestHTTPTLS(t *testing.T) {
+	var proto atomic.Int32
+	srv := httptest.NewUnstartedServer(ghttp.HandlerFunc(func(w ghttp.ResponseWriter, r *ghttp.Request) {
+		proto.Store(int32(r.ProtoMajor))
+		w.WriteHeader(ghttp.StatusOK)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the server certificate isn't trusted without the CA
+	_, err := New(WithMaxAttempts(1)).Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.ErrorContains(t, err, "certificate")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	resp, err := New(WithMaxAttempts(1), WithRootCAs(pool)).Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), proto.Load())
+
+	resp, err = New(WithMaxAttempts(1), WithRootCAs(pool), WithHTTP2(false)).Deliver(context.Background(), NewHTTPGetRequest(srv.URL, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ghttp.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), proto.Load())
+}